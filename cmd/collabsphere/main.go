@@ -5,6 +5,8 @@ import (
 	"embed"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"fmt"
 	"io/fs"
 	"log/slog"
 	"net/http"
@@ -13,10 +15,14 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Lec7ral/WithWebSocket/internal/audit"
 	"github.com/Lec7ral/WithWebSocket/internal/auth"
 	"github.com/Lec7ral/WithWebSocket/internal/config"
+	"github.com/Lec7ral/WithWebSocket/internal/filter"
 	"github.com/Lec7ral/WithWebSocket/internal/logger"
+	"github.com/Lec7ral/WithWebSocket/internal/ratelimit"
 	"github.com/Lec7ral/WithWebSocket/internal/repository"
+	"github.com/Lec7ral/WithWebSocket/internal/storage"
 	"github.com/Lec7ral/WithWebSocket/internal/websocket"
 	"github.com/go-chi/chi/v5"
 )
@@ -47,15 +53,49 @@ func main() {
 	defer repo.Close()
 	slog.Info("Database connection pool established.")
 
-	authService := auth.NewService(cfg.JWTSecret)
-	authHandler := auth.NewHandler(authService, repo)
+	auditLog := audit.NewLogger(repo)
+	defer auditLog.Close()
 
-	hub := websocket.NewHub(repo)
+	authService := auth.NewService(cfg.JWTSecret, cfg.AdminUserIDs, auditLog)
+	authHandler := auth.NewHandler(authService, repo, ratelimit.Rate{PerSecond: cfg.LoginRate, Burst: cfg.LoginBurst})
+
+	filters, err := filter.NewChain(filter.Config{
+		BannedWords:       cfg.FilterBannedWords,
+		BannedWordsAction: cfg.FilterBannedWordsAction,
+		LinkBlockedRooms:  cfg.FilterLinkBlockedRooms,
+		LinkAction:        cfg.FilterLinkAction,
+		MaxLength:         cfg.FilterMaxLength,
+		SpamMaxRepeats:    cfg.FilterSpamMaxRepeats,
+		SpamWindow:        cfg.FilterSpamWindow,
+	})
+	if err != nil {
+		slog.Error("Failed to configure message filters", "error", err)
+		os.Exit(1)
+	}
+
+	hub := websocket.NewHub(repo, filters, auditLog, websocket.MessageRates{
+		Chat:   ratelimit.Rate{PerSecond: cfg.WSChatRate, Burst: cfg.WSChatBurst},
+		Draw:   ratelimit.Rate{PerSecond: cfg.WSDrawRate, Burst: cfg.WSDrawBurst},
+		Typing: ratelimit.Rate{PerSecond: cfg.WSTypingRate, Burst: cfg.WSTypingBurst},
+		Board:  ratelimit.Rate{PerSecond: cfg.WSBoardRate, Burst: cfg.WSBoardBurst},
+
+		MaxViolations:   cfg.WSMaxRateViolations,
+		ViolationWindow: cfg.WSRateViolationWindow,
+	})
 	go hub.Run()
 	slog.Info("WebSocket Hub is running.")
 
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		slog.Error("Failed to create blob store", "error", err)
+		os.Exit(1)
+	}
+
 	router := chi.NewRouter()
-	wsHandler := websocket.NewHandler(hub, authService)
+	wsHandler := websocket.NewHandler(hub, authService, repo, blobs, cfg.MaxUploadSize, websocket.ConnLimits{
+		PerUser: cfg.WSMaxConnsPerUser,
+		PerIP:   cfg.WSMaxConnsPerIP,
+	})
 
 	// --- Static File Server Setup ---
 	// Create a sub-filesystem that starts in the 'static' directory.
@@ -71,9 +111,45 @@ func main() {
 
 	// --- API and WebSocket Routes ---
 	router.Post("/login", authHandler.HandleLogin)
+	apiLimiter := ratelimit.NewKeyedLimiter(ratelimit.Rate{PerSecond: cfg.APIRate, Burst: cfg.APIBurst})
 	router.Route("/api", func(r chi.Router) {
+		// API calls are limited per IP address.
+		r.Use(ratelimit.Middleware(apiLimiter, audit.RemoteAddr))
 		r.Get("/rooms", wsHandler.HandleGetRooms)
 		r.Get("/users/{userID}", authHandler.HandleGetUser)
+
+		// Routes below require a valid token.
+		r.Group(func(r chi.Router) {
+			r.Use(authService.Middleware)
+			r.Get("/rooms/{roomID}/messages", wsHandler.HandleGetRoomMessages)
+			r.Get("/rooms/{roomID}/messages/{id}/thread", wsHandler.HandleGetThread)
+			r.Get("/rooms/{roomID}/pins", wsHandler.HandleGetPins)
+			r.Post("/rooms/{roomID}/attachments", wsHandler.HandleUploadAttachment)
+			r.Get("/attachments/{attachmentID}", wsHandler.HandleGetAttachment)
+			r.Get("/attachments/{attachmentID}/thumbnail", wsHandler.HandleGetAttachmentThumbnail)
+			r.Put("/rooms/{roomID}/moderators/{userID}", wsHandler.HandleAddModerator)
+			r.Delete("/rooms/{roomID}/moderators/{userID}", wsHandler.HandleRemoveModerator)
+			r.Get("/dms", wsHandler.HandleGetDirectConversations)
+			r.Get("/dms/{userID}", wsHandler.HandleGetDirectMessages)
+			r.Post("/dms/{userID}/read", wsHandler.HandleMarkDirectMessagesRead)
+			r.Get("/search", wsHandler.HandleSearch)
+			r.Get("/mentions", wsHandler.HandleGetMentions)
+			r.Post("/mentions/read", wsHandler.HandleMarkMentionsRead)
+			r.Get("/conversations", wsHandler.HandleGetConversations)
+			r.Post("/conversations", wsHandler.HandleCreateConversation)
+			r.Get("/conversations/{conversationID}/messages", wsHandler.HandleGetConversationMessages)
+
+			// Admin routes additionally require the caller to be an admin.
+			r.Group(func(r chi.Router) {
+				r.Use(authService.AdminMiddleware)
+				r.Get("/admin/audit", wsHandler.HandleGetAuditEvents)
+				r.Get("/admin/clients", wsHandler.HandleListClients)
+				r.Delete("/admin/clients/{connID}", wsHandler.HandleDisconnectClient)
+				r.Delete("/admin/rooms/{roomID}", wsHandler.HandleCloseRoom)
+				r.Post("/admin/announcements", wsHandler.HandleAnnounce)
+				r.Handle("/admin/metrics", expvar.Handler())
+			})
+		})
 	})
 	router.Get("/health", func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -113,3 +189,21 @@ func main() {
 
 	slog.Info("Server stopped gracefully.")
 }
+
+// newBlobStore creates the store for uploaded files selected by the configuration.
+func newBlobStore(cfg *config.Config) (storage.BlobStore, error) {
+	switch cfg.BlobStore {
+	case "filesystem":
+		return storage.NewFileSystemStore(cfg.BlobDir)
+	case "s3":
+		return storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", cfg.BlobStore)
+	}
+}
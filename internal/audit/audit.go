@@ -0,0 +1,117 @@
+// Package audit records security-relevant events in the audit log.
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// queueSize is the number of events that can wait to be written.
+const queueSize = 1024
+
+// maxBatchSize is the largest number of events written at once.
+const maxBatchSize = 100
+
+// Store persists audit events.
+type Store interface {
+	SaveAuditEvents(ctx context.Context, events []*domain.AuditEvent) error
+}
+
+// Logger writes audit events to a Store in the background, so that recording an
+// event never blocks the caller, including the hub's event loop.
+type Logger struct {
+	store  Store
+	events chan *domain.AuditEvent
+	done   chan struct{}
+
+	// mu guards closed, so that events recorded while shutting down are dropped
+	// instead of being sent on the closed channel.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewLogger creates a logger and starts writing events to the store.
+func NewLogger(store Store) *Logger {
+	l := &Logger{
+		store:  store,
+		events: make(chan *domain.AuditEvent, queueSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// Record queues an event for writing, setting its time if missing. Events are only
+// dropped, and logged instead, if the store cannot keep up. Recording on a nil
+// Logger does nothing.
+func (l *Logger) Record(e domain.AuditEvent) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.events <- &e:
+	default:
+		slog.Warn("Audit queue full, event dropped", "type", e.Type, "actorID", e.ActorID, "roomID", e.RoomID, "targetID", e.TargetID)
+	}
+}
+
+// Close writes the queued events and stops the logger. Events recorded after Close
+// are dropped.
+func (l *Logger) Close() {
+	l.mu.Lock()
+	if !l.closed {
+		l.closed = true
+		close(l.events)
+	}
+	l.mu.Unlock()
+	<-l.done
+}
+
+// run writes queued events in batches until the logger is closed.
+func (l *Logger) run() {
+	defer close(l.done)
+	for e := range l.events {
+		batch := []*domain.AuditEvent{e}
+	fill:
+		for len(batch) < maxBatchSize {
+			select {
+			case next, ok := <-l.events:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, next)
+			default:
+				break fill
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := l.store.SaveAuditEvents(ctx, batch); err != nil {
+			slog.Error("Failed to write audit events", "error", err, "count", len(batch))
+		}
+		cancel()
+	}
+}
+
+// RemoteAddr returns the IP address of the client of a request.
+func RemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
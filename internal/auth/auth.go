@@ -8,7 +8,9 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Lec7ral/WithWebSocket/internal/audit"
 	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/ratelimit"
 	"github.com/Lec7ral/WithWebSocket/internal/repository"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
@@ -27,14 +29,47 @@ type Claims struct {
 type Service struct {
 	jwtSecret  string
 	jwtExpires time.Duration
+
+	// adminIDs are the IDs of the users allowed to use the admin API.
+	adminIDs map[string]bool
+
+	auditLog *audit.Logger
 }
 
-// NewService creates a new authentication service.
-func NewService(jwtSecret string) *Service {
+// NewService creates a new authentication service. Failed token validations and
+// logins are recorded in the audit log.
+func NewService(jwtSecret string, adminIDs []string, auditLog *audit.Logger) *Service {
+	admins := make(map[string]bool, len(adminIDs))
+	for _, id := range adminIDs {
+		if id != "" {
+			admins[id] = true
+		}
+	}
 	return &Service{
 		jwtSecret:  jwtSecret,
 		jwtExpires: 24 * time.Hour,
+		adminIDs:   admins,
+		auditLog:   auditLog,
+	}
+}
+
+// IsAdmin reports whether a user may use the admin API.
+func (s *Service) IsAdmin(userID string) bool {
+	return s.adminIDs[userID]
+}
+
+// ValidateRequestToken validates a token sent with a request, recording failures in
+// the audit log.
+func (s *Service) ValidateRequestToken(r *http.Request, tokenString string) (*Claims, error) {
+	claims, err := s.ValidateToken(tokenString)
+	if err != nil {
+		s.auditLog.Record(domain.AuditEvent{
+			Type:       domain.AuditTokenFailure,
+			RemoteAddr: audit.RemoteAddr(r),
+			Details:    map[string]string{"error": err.Error(), "path": r.URL.Path},
+		})
 	}
+	return claims, err
 }
 
 // GenerateToken generates a new JWT for a given user.
@@ -76,13 +111,18 @@ func (s *Service) ValidateToken(tokenString string) (*Claims, error) {
 type Handler struct {
 	service *Service
 	repo    repository.Repository
+
+	// loginLimiter throttles login attempts per IP address and per username.
+	loginLimiter *ratelimit.KeyedLimiter
 }
 
-// NewHandler creates a new authentication handler.
-func NewHandler(service *Service, repo repository.Repository) *Handler {
+// NewHandler creates a new authentication handler. Login attempts are limited to
+// loginRate per IP address and per username.
+func NewHandler(service *Service, repo repository.Repository, loginRate ratelimit.Rate) *Handler {
 	return &Handler{
-		service: service,
-		repo:    repo,
+		service:      service,
+		repo:         repo,
+		loginLimiter: ratelimit.NewKeyedLimiter(loginRate),
 	}
 }
 
@@ -107,6 +147,14 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Username is required", http.StatusBadRequest)
 		return
 	}
+	remoteAddr := audit.RemoteAddr(r)
+	for _, key := range []string{"ip:" + remoteAddr, "user:" + req.Username} {
+		if ok, retryAfter := h.loginLimiter.Allow(key); !ok {
+			slog.Warn("Login attempt throttled", "username", req.Username, "remoteAddr", remoteAddr)
+			ratelimit.TooManyRequests(w, retryAfter)
+			return
+		}
+	}
 
 	user, err := h.repo.FindOrCreateUserByUsername(context.Background(), req.Username)
 	if err != nil {
@@ -121,6 +169,12 @@ func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	h.service.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditLogin,
+		ActorID:    user.ID,
+		ActorName:  user.UserName,
+		RemoteAddr: remoteAddr,
+	})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
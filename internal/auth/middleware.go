@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// claimsContextKey is the context key under which Middleware stores the token claims.
+type claimsContextKey struct{}
+
+// Middleware rejects requests without a valid token and stores the token's claims in
+// the request context. The token is read from the Authorization header as a bearer
+// token or, like the WebSocket endpoint, from the token query parameter.
+func (s *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokenString == "" {
+			tokenString = r.URL.Query().Get("token")
+		}
+		if tokenString == "" {
+			http.Error(w, "Token is required", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := s.ValidateRequestToken(r, tokenString)
+		if err != nil {
+			slog.Warn("Invalid API token received", "error", err, "path", r.URL.Path)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), claimsContextKey{}, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// AdminMiddleware rejects requests from users who are not admins. It must be used
+// after Middleware.
+func (s *Service) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if !ok || !s.IsAdmin(claims.UserID) {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClaimsFromContext returns the claims stored in the context by Middleware.
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
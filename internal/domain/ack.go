@@ -0,0 +1,65 @@
+package domain
+
+import "time"
+
+// AckPayload is sent back to a client once one of its messages has been accepted.
+type AckPayload struct {
+	// ClientMsgID echoes the identifier supplied by the client, if any.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	// MessageID is the persistent identifier assigned by the server.
+	MessageID int64 `json:"message_id"`
+
+	// Timestamp is the server time at which the message was stored.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Duplicate is true when the message had already been accepted earlier,
+	// typically because the client retried it after a reconnect.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+// Machine-readable codes of the `error` message.
+const (
+	ErrorInvalidPayload  = "invalid_payload"
+	ErrorUnauthorized    = "unauthorized"
+	ErrorRateLimited     = "rate_limited"
+	ErrorTooLarge        = "too_large"
+	ErrorUnknownType     = "unknown_type"
+	ErrorNotFound        = "not_found"
+	ErrorLimitExceeded   = "limit_exceeded"
+	ErrorContentRejected = "content_rejected"
+	ErrorInternal        = "internal_error"
+)
+
+// ErrorPayload is sent back to a client as `error` when one of its messages was
+// rejected.
+type ErrorPayload struct {
+	// ClientMsgID echoes the identifier supplied by the client, if any.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	// Code is one of the Error* codes, for clients to act upon.
+	Code string `json:"code"`
+
+	// Message is a human readable description of the problem.
+	Message string `json:"message"`
+
+	// RetryAfterMs tells a rate limited client how many milliseconds to wait before
+	// sending again.
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+// FilterNoticePayload is sent back to a client as `message_filtered` when one of its
+// messages was accepted but masked or flagged by the content filters.
+type FilterNoticePayload struct {
+	// ClientMsgID echoes the identifier supplied by the client, if any.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	// MessageID is the persistent identifier of the stored message.
+	MessageID int64 `json:"message_id,omitempty"`
+
+	// Action is "mask" or "flag".
+	Action string `json:"action"`
+
+	// Reason is a human readable description of what the filters objected to.
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,10 @@
+package domain
+
+// AnnouncementPayload is the payload of the `system_announcement` event an
+// administrator broadcasts to one or all rooms.
+type AnnouncementPayload struct {
+	Text string `json:"text"`
+
+	// From is the username of the administrator who made the announcement.
+	From string `json:"from"`
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "time"
+
+// Attachment is a file uploaded to a room, such as a screenshot shared in the chat.
+type Attachment struct {
+	ID          string `json:"id"`
+	RoomID      string `json:"room_id"`
+	UploaderID  string `json:"uploader_id"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+
+	// Width and Height are the dimensions of image attachments.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+
+	// URL and ThumbnailURL are the download URLs of the file and of its thumbnail, if
+	// one was generated. Downloads require a token of a member of the room.
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+
+	// BlobKey and ThumbnailKey locate the stored files in the blob store.
+	BlobKey      string `json:"-"`
+	ThumbnailKey string `json:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AttachmentPayload is the payload of an `attachment` message sent by a client. It
+// shares a previously uploaded file in the room, with an optional caption.
+type AttachmentPayload struct {
+	AttachmentID string `json:"attachment_id"`
+	Caption      string `json:"caption,omitempty"`
+}
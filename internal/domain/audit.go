@@ -0,0 +1,55 @@
+package domain
+
+import "time"
+
+// Audit event types.
+const (
+	AuditLogin        = "login"
+	AuditTokenFailure = "token_failure"
+	AuditRoomJoin     = "room_join"
+	AuditRoomLeave    = "room_leave"
+	AuditClearBoard   = "clear_board"
+	AuditModeration   = "moderation"
+	AuditRoleChange   = "role_change"
+	AuditGroupCreated = "conversation_created"
+	AuditAdminAction  = "admin_action"
+)
+
+// AuditEvent is an entry of the append-only audit log of security-relevant events.
+type AuditEvent struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	// ActorID and ActorName identify the user who caused the event, if known.
+	ActorID   string `json:"actor_id,omitempty"`
+	ActorName string `json:"actor_name,omitempty"`
+
+	RoomID string `json:"room_id,omitempty"`
+
+	// TargetID is the user or conversation the event applies to, if any.
+	TargetID string `json:"target_id,omitempty"`
+
+	RemoteAddr string `json:"remote_addr,omitempty"`
+
+	// Details holds event specific information, such as the reason of a moderation
+	// action or the error of a token failure.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// AuditQuery filters audit events. Zero fields do not filter.
+type AuditQuery struct {
+	Type     string
+	ActorID  string
+	RoomID   string
+	TargetID string
+
+	// From and To restrict the events to the interval [From, To).
+	From time.Time
+	To   time.Time
+
+	// BeforeID pages backwards: only events with a lower ID are returned.
+	BeforeID int64
+
+	Limit int
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "time"
+
+// Conversation is an ad-hoc group conversation between three or more users,
+// independent of room membership.
+type Conversation struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	CreatedBy    string    `json:"created_by"`
+	CreatedAt    time.Time `json:"created_at"`
+	Participants []*User   `json:"participants"`
+}
+
+// GroupMessagePayload defines the structure for the payload of a group conversation message.
+type GroupMessagePayload struct {
+	// ConversationID is the ID of the conversation the message is sent to.
+	ConversationID string `json:"conversation_id"`
+
+	// Content is the actual text message.
+	Content string `json:"content"`
+}
+
+// GroupMessage is a stored message of a group conversation.
+type GroupMessage struct {
+	ID             int64  `json:"id"`
+	ConversationID string `json:"conversation_id"`
+	SenderID       string `json:"sender_id"`
+	SenderName     string `json:"sender_name,omitempty"`
+	Content        string `json:"content"`
+
+	// ClientMsgID is the optional identifier the sender used to deduplicate retries.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
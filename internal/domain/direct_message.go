@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 // DirectMessagePayload defines the structure for the payload of a direct message.
 type DirectMessagePayload struct {
 	// RecipientID is the ID of the user who should receive the message.
@@ -8,3 +10,63 @@ type DirectMessagePayload struct {
 	// Content is the actual text message.
 	Content string `json:"content"`
 }
+
+// DirectMessage is a stored private message between two users.
+type DirectMessage struct {
+	ID          int64  `json:"id"`
+	SenderID    string `json:"sender_id"`
+	SenderName  string `json:"sender_name,omitempty"`
+	RecipientID string `json:"recipient_id"`
+	Content     string `json:"content"`
+
+	// ClientMsgID is the optional identifier the sender used to deduplicate retries.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+
+	// DeliveredAt is set once the message reached one of the recipient's connections.
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// DirectConversation summarizes the direct messages a user exchanged with one peer.
+type DirectConversation struct {
+	PeerID   string `json:"peer_id"`
+	PeerName string `json:"peer_name"`
+
+	// LastMessage is the most recent message of the conversation, in either direction.
+	LastMessage *DirectMessage `json:"last_message"`
+
+	// UnreadCount is the number of messages from the peer the user has not read yet.
+	UnreadCount int `json:"unread_count"`
+}
+
+// DirectMessageReadPayload moves a read pointer in a conversation. A recipient sends it
+// as `dm_read` with PeerID set to the other participant, and the server forwards it to
+// that participant with PeerID set to the reader.
+type DirectMessageReadPayload struct {
+	PeerID     string `json:"peer_id"`
+	LastReadID int64  `json:"last_read_id"`
+}
+
+// DirectMessageDeliveredPayload tells a sender that a direct message reached one of
+// the recipient's connections.
+type DirectMessageDeliveredPayload struct {
+	MessageID   int64     `json:"message_id"`
+	RecipientID string    `json:"recipient_id"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// DirectMessageFailedPayload tells a sender that a direct message could not be delivered.
+type DirectMessageFailedPayload struct {
+	// ClientMsgID echoes the identifier supplied by the client, if any.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+
+	// MessageID is set when the message was stored despite the failure, in which case
+	// it is delivered when the recipient next connects.
+	MessageID int64 `json:"message_id,omitempty"`
+
+	RecipientID string `json:"recipient_id"`
+
+	// Reason is one of "unknown_recipient", "not_stored" or "recipient_unreachable".
+	Reason string `json:"reason"`
+}
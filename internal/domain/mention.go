@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// Mention records that a chat message mentioned a user with @username.
+type Mention struct {
+	MessageID  int64      `json:"message_id"`
+	RoomID     string     `json:"room_id"`
+	SenderID   string     `json:"sender_id"`
+	SenderName string     `json:"sender_name,omitempty"`
+	Content    string     `json:"content"`
+	Timestamp  time.Time  `json:"timestamp"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+}
@@ -1,11 +1,56 @@
 package domain
 
+import "time"
+
 // Message defines the structure for messages exchanged via WebSocket.
 type Message struct {
 	Type    string `json:"type"`
 	Payload any    `json:"payload"`
 	Sender  string `json:"sender,omitempty"`
 
+	// HTML is the sanitized rendering of a chat message's Markdown payload.
+	HTML string `json:"html,omitempty"`
+
+	// SenderName is the display name of the sender at the time the message was sent.
+	SenderName string `json:"sender_name,omitempty"`
+
 	// RoomID is the identifier of the room this message belongs to.
 	RoomID string `json:"room_id,omitempty"`
+
+	// ID is the persistent identifier assigned by the server once the message is stored.
+	ID int64 `json:"id,omitempty"`
+
+	// Timestamp is the server time at which the message was stored. omitempty makes
+	// the MessagePack codec, which ignores omitzero, leave out zero times too.
+	Timestamp time.Time `json:"timestamp,omitempty,omitzero"`
+
+	// EditedAt is set once the message content has been edited.
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+
+	// Deleted is set on messages that were deleted; their content is not returned.
+	Deleted bool `json:"deleted,omitempty"`
+
+	// ParentID is the ID of the message this one replies to, if it is part of a thread.
+	ParentID int64 `json:"parent_id,omitempty"`
+
+	// ReplyCount and LastReplyAt describe the thread started by this message, if any.
+	ReplyCount  int        `json:"reply_count,omitempty"`
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"`
+
+	// Mentions lists the IDs of the room members mentioned in a chat message.
+	Mentions []string `json:"mentions,omitempty"`
+
+	// Attachment is the file shared by an `attachment` message.
+	Attachment *Attachment `json:"attachment,omitempty"`
+
+	// Reactions aggregates the emoji reactions on a stored chat message.
+	Reactions []ReactionSummary `json:"reactions,omitempty"`
+
+	// Seq is the per-room sequence number of broadcast events, used by clients to
+	// resume after a reconnect.
+	Seq int64 `json:"seq,omitempty"`
+
+	// ClientMsgID is an optional identifier chosen by the client so it can match
+	// acknowledgements to the messages it sent and safely retry them.
+	ClientMsgID string `json:"client_msg_id,omitempty"`
 }
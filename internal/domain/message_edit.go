@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// MessageEditPayload is the payload of the `edit_message` and `delete_message`
+// requests. Content is only used when editing.
+type MessageEditPayload struct {
+	// MessageID is the persistent identifier of the chat message to change.
+	MessageID int64 `json:"message_id"`
+
+	Content string `json:"content,omitempty"`
+}
+
+// MessageUpdatedPayload is broadcast to a room as `message_updated` after a chat
+// message was edited.
+type MessageUpdatedPayload struct {
+	MessageID int64     `json:"message_id"`
+	Content   string    `json:"content"`
+	HTML      string    `json:"html"`
+	EditedBy  string    `json:"edited_by"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+// MessageDeletedPayload is broadcast to a room as `message_deleted` after a chat
+// message was deleted.
+type MessageDeletedPayload struct {
+	MessageID int64     `json:"message_id"`
+	DeletedBy string    `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+// Moderation actions, used as the `action` of moderation events and audit records.
+const (
+	ModerationKick   = "kick"
+	ModerationMute   = "mute"
+	ModerationUnmute = "unmute"
+	ModerationBan    = "ban"
+	ModerationUnban  = "unban"
+)
+
+// ModerationPayload is the payload of the `kick_user`, `mute_user`, `unmute_user`,
+// `ban_user` and `unban_user` moderator commands.
+type ModerationPayload struct {
+	// UserID is the user the command applies to.
+	UserID string `json:"user_id"`
+
+	Reason string `json:"reason,omitempty"`
+
+	// DurationSeconds is how long a mute lasts. It is required for `mute_user`.
+	DurationSeconds int `json:"duration_seconds,omitempty"`
+}
+
+// ModerationAction records a moderation command applied to a user in a room. It is
+// broadcast to the room, and sent to the affected user, as `moderation_action`.
+type ModerationAction struct {
+	Action      string `json:"action"`
+	RoomID      string `json:"room_id"`
+	UserID      string `json:"user_id"`
+	ModeratorID string `json:"moderator_id"`
+	Reason      string `json:"reason,omitempty"`
+
+	// ExpiresAt is the end of a mute.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// PinPayload is the payload of the `pin_message` and `unpin_message` requests.
+type PinPayload struct {
+	// MessageID is the persistent identifier of the chat message to pin or unpin.
+	MessageID int64 `json:"message_id"`
+}
+
+// PinnedMessage is a chat message pinned to its room by a moderator.
+type PinnedMessage struct {
+	Message  *Message  `json:"message"`
+	PinnedBy string    `json:"pinned_by"`
+	PinnedAt time.Time `json:"pinned_at"`
+}
+
+// PinsUpdatedPayload is broadcast to a room as `pins_updated` whenever its pinned
+// messages change. It always carries the complete list of pins, oldest first.
+type PinsUpdatedPayload struct {
+	Pins []*PinnedMessage `json:"pins"`
+}
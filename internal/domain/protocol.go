@@ -0,0 +1,59 @@
+package domain
+
+import "time"
+
+// HelloPayload is the payload of the `hello` message a client may send first to
+// negotiate the protocol version when it could not use the Sec-WebSocket-Protocol
+// header.
+type HelloPayload struct {
+	// Versions lists the protocol versions the client supports.
+	Versions []int `json:"versions"`
+
+	// Encodings optionally lists the codecs the client can decode besides JSON, such
+	// as "msgpack".
+	Encodings []string `json:"encodings,omitempty"`
+}
+
+// WelcomePayload is sent as `welcome` once a protocol version was negotiated. It
+// describes what the server supports and the limits the client must respect.
+type WelcomePayload struct {
+	// Version is the negotiated version, and Protocol the matching subprotocol name.
+	Version  int    `json:"version"`
+	Protocol string `json:"protocol"`
+
+	// Versions lists every protocol version the server supports.
+	Versions []int `json:"versions"`
+
+	// Encoding is the codec of the following messages, and Encodings lists every
+	// codec the server supports.
+	Encoding  string   `json:"encoding"`
+	Encodings []string `json:"encodings"`
+
+	// Features lists the optional parts of the protocol available to the client.
+	Features []string `json:"features"`
+
+	Limits ProtocolLimits `json:"limits"`
+
+	// ConnID identifies the connection, for example in support requests.
+	ConnID     string    `json:"conn_id"`
+	ServerTime time.Time `json:"server_time"`
+}
+
+// ProtocolLimits are the limits of the server a client must respect.
+type ProtocolLimits struct {
+	// MaxMessageSize is the largest frame the server accepts, in bytes.
+	MaxMessageSize int `json:"max_message_size"`
+
+	// MaxContentLength is the longest chat message, in characters.
+	MaxContentLength int `json:"max_content_length"`
+
+	// Rates holds the rate limit of each class of message: "chat", "draw" and
+	// "typing". Unlimited classes are omitted.
+	Rates map[string]RateLimit `json:"rates"`
+}
+
+// RateLimit allows PerSecond messages per second on average, in bursts of Burst.
+type RateLimit struct {
+	PerSecond float64 `json:"per_second"`
+	Burst     int     `json:"burst"`
+}
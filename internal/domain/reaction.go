@@ -0,0 +1,23 @@
+package domain
+
+// ReactionPayload is the payload of the `add_reaction` and `remove_reaction` requests.
+type ReactionPayload struct {
+	// MessageID is the persistent identifier of the chat message reacted to.
+	MessageID int64 `json:"message_id"`
+
+	Emoji string `json:"emoji"`
+}
+
+// ReactionSummary aggregates the reactions with one emoji on a message.
+type ReactionSummary struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// ReactionsUpdatedPayload is broadcast to a room as `reactions_updated` whenever the
+// reactions on a message change. It always carries the complete set of reactions.
+type ReactionsUpdatedPayload struct {
+	MessageID int64             `json:"message_id"`
+	Reactions []ReactionSummary `json:"reactions"`
+}
@@ -1,5 +1,12 @@
 package domain
 
+// Room roles. The user who opens a room first becomes its owner, and owners may
+// appoint moderators. Owners have every moderator permission.
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+)
+
 // RoomState represents the complete state of a room at a given moment.
 // It will be sent to a user when they join the room.
 type RoomState struct {
@@ -7,4 +14,28 @@ type RoomState struct {
 	Users []*User `json:"users"`
 
 	Whiteboard *WhiteboardState `json:"whiteboard"`
+
+	// Pins are the messages pinned to the room, oldest pin first.
+	Pins []*PinnedMessage `json:"pins"`
+
+	// Seq is the sequence number of the latest event in the room. Clients pass it
+	// back as the `since` parameter when reconnecting.
+	Seq int64 `json:"seq"`
+
+	// Messages holds chat messages the client missed while disconnected, when it
+	// reconnected too late to be resumed from the in-memory replay buffer.
+	Messages []*Message `json:"messages,omitempty"`
+}
+
+// RoomResume is sent instead of RoomState to a client that reconnects with a
+// sequence number the server can still replay from.
+type RoomResume struct {
+	// Users is the list of all users currently in the room.
+	Users []*User `json:"users"`
+
+	// Seq is the sequence number of the latest event in the room.
+	Seq int64 `json:"seq"`
+
+	// Events are the room events the client missed, oldest first.
+	Events []*Message `json:"events"`
 }
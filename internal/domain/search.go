@@ -0,0 +1,49 @@
+package domain
+
+import "time"
+
+// SearchQuery describes a full-text search across the chat history of the rooms a
+// user has joined.
+type SearchQuery struct {
+	// UserID is the user searching; only rooms they are a member of are searched.
+	UserID string
+
+	// Text is the search text, in web search syntax: quoted phrases, OR and -word.
+	Text string
+
+	// RoomID and SenderID optionally restrict the search to one room or sender.
+	RoomID   string
+	SenderID string
+
+	// From and To optionally restrict the search to messages sent in [From, To).
+	From time.Time
+	To   time.Time
+
+	Limit  int
+	Offset int
+}
+
+// SearchHit is a chat message matching a search, with the matching terms highlighted.
+type SearchHit struct {
+	MessageID  int64     `json:"message_id"`
+	RoomID     string    `json:"room_id"`
+	SenderID   string    `json:"sender_id"`
+	SenderName string    `json:"sender_name,omitempty"`
+	ParentID   int64     `json:"parent_id,omitempty"`
+	Content    string    `json:"content"`
+	Timestamp  time.Time `json:"timestamp"`
+
+	// Highlight is an HTML excerpt of the message with matches wrapped in <mark> tags.
+	// Everything else in it is escaped.
+	Highlight string `json:"highlight"`
+
+	Rank float64 `json:"rank"`
+}
+
+// SearchResults is a page of search hits, best matches first.
+type SearchResults struct {
+	Hits []*SearchHit `json:"hits"`
+
+	// NextOffset is the offset of the next page, or 0 if there are no more hits.
+	NextOffset int `json:"next_offset,omitempty"`
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "time"
+
+// Thread is a chat message together with the replies it received.
+type Thread struct {
+	Parent  *Message   `json:"parent"`
+	Replies []*Message `json:"replies"`
+}
+
+// ThreadUpdatedPayload is broadcast to a room as `thread_updated` when a message
+// receives a reply.
+type ThreadUpdatedPayload struct {
+	MessageID   int64     `json:"message_id"`
+	ReplyCount  int       `json:"reply_count"`
+	LastReplyAt time.Time `json:"last_reply_at"`
+}
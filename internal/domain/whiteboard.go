@@ -6,4 +6,34 @@ type DrawEvent struct {
 }
 type WhiteboardState struct {
 	Events []DrawEvent `json:"events"`
+
+	// Images are the images placed on the board, in stacking order from bottom to top.
+	Images []*WhiteboardImage `json:"images,omitempty"`
+}
+
+// WhiteboardImage is an `image` whiteboard element: an uploaded image attachment of
+// the room placed on the board. It is the payload of the `image_add`, `image_update`
+// and `image_remove` messages.
+type WhiteboardImage struct {
+	// ID identifies the element on the board. It is assigned by the server when the
+	// image is added.
+	ID string `json:"id"`
+
+	AttachmentID string `json:"attachment_id"`
+
+	// X and Y are the position of the top-left corner of the image before rotation.
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+
+	// Rotation is the clockwise rotation around the center of the image, in degrees.
+	Rotation float64 `json:"rotation"`
+
+	// URL is the download URL of the attachment. Like every attachment, it can only be
+	// downloaded by members of the room.
+	URL string `json:"url,omitempty"`
+
+	AddedBy string `json:"added_by,omitempty"`
 }
@@ -0,0 +1,58 @@
+package filter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config selects and configures the filters of a chain.
+type Config struct {
+	// BannedWords are matched as whole words, ignoring case, and handled with
+	// BannedWordsAction.
+	BannedWords       []string
+	BannedWordsAction string
+
+	// LinkBlockedRooms lists the rooms, or "*" for all rooms, where links are
+	// handled with LinkAction.
+	LinkBlockedRooms []string
+	LinkAction       string
+
+	// MaxLength is the maximum number of characters in a message, or 0 for no limit.
+	MaxLength int
+
+	// SpamMaxRepeats is how many identical messages in a row a sender may post within
+	// SpamWindow, or 0 to allow any number.
+	SpamMaxRepeats int
+	SpamWindow     time.Duration
+}
+
+// NewChain builds the chain of filters enabled by a configuration. Cheap checks run
+// before the ones that keep state.
+func NewChain(cfg Config) (Chain, error) {
+	var chain Chain
+	if f := NewMaxLength(cfg.MaxLength); f != nil {
+		chain = append(chain, f)
+	}
+	if len(cfg.BannedWords) > 0 {
+		action, ok := ParseAction(cfg.BannedWordsAction)
+		if !ok {
+			return nil, fmt.Errorf("unknown banned words action %q", cfg.BannedWordsAction)
+		}
+		if f := NewBannedWords(cfg.BannedWords, action); f != nil {
+			chain = append(chain, f)
+		}
+	}
+	if len(cfg.LinkBlockedRooms) > 0 {
+		action, ok := ParseAction(cfg.LinkAction)
+		if !ok {
+			return nil, fmt.Errorf("unknown link action %q", cfg.LinkAction)
+		}
+		if f := NewLinkBlocker(cfg.LinkBlockedRooms, action); f != nil {
+			chain = append(chain, f)
+		}
+	}
+	if f := NewRepeatedMessages(cfg.SpamMaxRepeats, cfg.SpamWindow); f != nil {
+		chain = append(chain, f)
+	}
+	return chain, nil
+}
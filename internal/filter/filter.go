@@ -0,0 +1,117 @@
+// Package filter checks chat messages against content rules before they are stored
+// and broadcast.
+package filter
+
+import "strings"
+
+// Action is what a filter decides to do with a message.
+type Action int
+
+const (
+	// Allow lets the message through unchanged.
+	Allow Action = iota
+
+	// Flag lets the message through but marks it for review by moderators.
+	Flag
+
+	// Mask lets the message through with the offending parts replaced.
+	Mask
+
+	// Reject refuses the message.
+	Reject
+)
+
+// String returns the name of the action used in configuration and notifications.
+func (a Action) String() string {
+	switch a {
+	case Flag:
+		return "flag"
+	case Mask:
+		return "mask"
+	case Reject:
+		return "reject"
+	}
+	return "allow"
+}
+
+// ParseAction parses the name of an action, reporting false for unknown names.
+func ParseAction(name string) (Action, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "allow":
+		return Allow, true
+	case "flag":
+		return Flag, true
+	case "mask":
+		return Mask, true
+	case "reject":
+		return Reject, true
+	}
+	return Allow, false
+}
+
+// Message is the part of a chat message that filters inspect.
+type Message struct {
+	RoomID   string
+	SenderID string
+	Content  string
+
+	// Edit is set when Content is the new content of an edited message.
+	Edit bool
+}
+
+// Verdict is the decision of a filter about a message.
+type Verdict struct {
+	Action Action
+
+	// Reason explains the decision to the sender. It is empty for Allow.
+	Reason string
+
+	// Content is the masked content when Action is Mask.
+	Content string
+}
+
+// MessageFilter inspects chat messages. Filters are called from the hub's event
+// loop, one message at a time, and must not block.
+type MessageFilter interface {
+	Filter(msg Message) Verdict
+}
+
+// Result is the combined decision of a chain of filters.
+type Result struct {
+	// Rejected is set when a filter rejected the message; Reason says why.
+	Rejected bool
+	Reason   string
+
+	// Content is the message content after masking, and Masked whether it changed.
+	Content string
+	Masked  bool
+
+	// Flags lists the reasons the message was flagged for, if any.
+	Flags []string
+}
+
+// Chain applies filters in order. The first rejection stops the chain; masked
+// content is passed on to the filters after the one that masked it.
+type Chain []MessageFilter
+
+// Apply runs a message through the chain.
+func (ch Chain) Apply(msg Message) Result {
+	result := Result{Content: msg.Content}
+	for _, f := range ch {
+		msg.Content = result.Content
+		v := f.Filter(msg)
+		switch v.Action {
+		case Reject:
+			return Result{Rejected: true, Reason: v.Reason, Content: msg.Content}
+		case Mask:
+			result.Content = v.Content
+			result.Masked = true
+			if v.Reason != "" {
+				result.Reason = v.Reason
+			}
+		case Flag:
+			result.Flags = append(result.Flags, v.Reason)
+		}
+	}
+	return result
+}
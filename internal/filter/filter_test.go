@@ -0,0 +1,114 @@
+package filter
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestChainApply(t *testing.T) {
+	chain, err := NewChain(Config{
+		BannedWords:       []string{"darn"},
+		BannedWordsAction: "mask",
+		LinkBlockedRooms:  []string{"kids"},
+		LinkAction:        "reject",
+		MaxLength:         20,
+	})
+	if err != nil {
+		t.Fatalf("NewChain: %v", err)
+	}
+	flagging := append(Chain{NewBannedWords([]string{"heck"}, Flag)}, chain...)
+
+	tests := []struct {
+		name  string
+		chain Chain
+		msg   Message
+		want  Result
+	}{
+		{
+			name:  "allow",
+			chain: chain,
+			msg:   Message{RoomID: "general", Content: "hello"},
+			want:  Result{Content: "hello"},
+		},
+		{
+			name:  "mask",
+			chain: chain,
+			msg:   Message{RoomID: "general", Content: "Darn it, darnit"},
+			want:  Result{Content: "#### it, darnit", Masked: true, Reason: "message contains banned words"},
+		},
+		{
+			name:  "reject link",
+			chain: chain,
+			msg:   Message{RoomID: "kids", Content: "see www.example.com"},
+			want:  Result{Rejected: true, Reason: "links are not allowed in this room", Content: "see www.example.com"},
+		},
+		{
+			name:  "link allowed elsewhere",
+			chain: chain,
+			msg:   Message{RoomID: "general", Content: "see www.example.com"},
+			want:  Result{Content: "see www.example.com"},
+		},
+		{
+			name:  "reject too long",
+			chain: chain,
+			msg:   Message{RoomID: "general", Content: "this message is far too long"},
+			want:  Result{Rejected: true, Reason: "message is longer than 20 characters", Content: "this message is far too long"},
+		},
+		{
+			name:  "mask before reject",
+			chain: chain,
+			msg:   Message{RoomID: "kids", Content: "darn www.x.com"},
+			want:  Result{Rejected: true, Reason: "links are not allowed in this room", Content: "#### www.x.com"},
+		},
+		{
+			name:  "flag and mask",
+			chain: flagging,
+			msg:   Message{RoomID: "general", Content: "heck, darn"},
+			want:  Result{Content: "heck, ####", Masked: true, Reason: "message contains banned words", Flags: []string{"message contains banned words"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.chain.Apply(tt.msg)
+			if got.Rejected != tt.want.Rejected || got.Reason != tt.want.Reason || got.Content != tt.want.Content ||
+				got.Masked != tt.want.Masked || !slices.Equal(got.Flags, tt.want.Flags) {
+				t.Errorf("Apply(%+v) = %+v, want %+v", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewChainUnknownAction(t *testing.T) {
+	if _, err := NewChain(Config{BannedWords: []string{"darn"}, BannedWordsAction: "shout"}); err == nil {
+		t.Error("NewChain accepted an unknown action")
+	}
+}
+
+func TestRepeatedMessages(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	f := NewRepeatedMessages(2, 30*time.Second)
+	f.now = func() time.Time { return now }
+
+	steps := []struct {
+		advance time.Duration
+		msg     Message
+		want    Action
+	}{
+		{msg: Message{RoomID: "r", SenderID: "a", Content: "buy now"}, want: Allow},
+		{msg: Message{RoomID: "r", SenderID: "a", Content: "BUY  now"}, want: Allow},
+		{msg: Message{RoomID: "r", SenderID: "a", Content: "buy now"}, want: Reject},
+		{msg: Message{RoomID: "r", SenderID: "a", Content: "buy now", Edit: true}, want: Allow},
+		{msg: Message{RoomID: "r", SenderID: "b", Content: "buy now"}, want: Allow},
+		{msg: Message{RoomID: "other", SenderID: "a", Content: "buy now"}, want: Allow},
+		{advance: 31 * time.Second, msg: Message{RoomID: "r", SenderID: "a", Content: "buy now"}, want: Allow},
+		{msg: Message{RoomID: "r", SenderID: "a", Content: "something else"}, want: Allow},
+		{msg: Message{RoomID: "r", SenderID: "a", Content: "buy now"}, want: Allow},
+	}
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		if got := f.Filter(step.msg).Action; got != step.want {
+			t.Errorf("step %d: Filter(%+v) = %v, want %v", i, step.msg, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// BannedWords matches whole words from a list, ignoring case.
+type BannedWords struct {
+	action  Action
+	pattern *regexp.Regexp
+}
+
+// NewBannedWords creates a filter applying action to messages containing any of the
+// words. Masking replaces each character of a banned word with '#', since asterisks
+// would be taken for Markdown emphasis. It returns nil if the list is empty.
+func NewBannedWords(words []string, action Action) *BannedWords {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	pattern := regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)
+	return &BannedWords{action: action, pattern: pattern}
+}
+
+// Filter implements MessageFilter.
+func (f *BannedWords) Filter(msg Message) Verdict {
+	if !f.pattern.MatchString(msg.Content) {
+		return Verdict{}
+	}
+	v := Verdict{Action: f.action, Reason: "message contains banned words"}
+	if f.action == Mask {
+		v.Content = f.pattern.ReplaceAllStringFunc(msg.Content, func(word string) string {
+			return strings.Repeat("#", utf8.RuneCountInString(word))
+		})
+	}
+	return v
+}
+
+// linkPattern matches bare URLs, www. addresses and Markdown links.
+var linkPattern = regexp.MustCompile(`(?i)\[[^\]]*\]\([^)]*\)|\b(?:https?://|www\.)\S+`)
+
+// LinkBlocker applies an action to messages containing links in a set of rooms.
+type LinkBlocker struct {
+	action Action
+	rooms  map[string]bool
+}
+
+// NewLinkBlocker creates a filter blocking links in the given rooms, or in every
+// room if the list contains "*". Masking replaces each link with a placeholder. It
+// returns nil if the list is empty.
+func NewLinkBlocker(roomIDs []string, action Action) *LinkBlocker {
+	rooms := make(map[string]bool)
+	for _, id := range roomIDs {
+		if id = strings.TrimSpace(id); id != "" {
+			rooms[id] = true
+		}
+	}
+	if len(rooms) == 0 {
+		return nil
+	}
+	return &LinkBlocker{action: action, rooms: rooms}
+}
+
+// Filter implements MessageFilter.
+func (f *LinkBlocker) Filter(msg Message) Verdict {
+	if !f.rooms[msg.RoomID] && !f.rooms["*"] {
+		return Verdict{}
+	}
+	if !linkPattern.MatchString(msg.Content) {
+		return Verdict{}
+	}
+	v := Verdict{Action: f.action, Reason: "links are not allowed in this room"}
+	if f.action == Mask {
+		v.Content = linkPattern.ReplaceAllString(msg.Content, "[link removed]")
+	}
+	return v
+}
+
+// MaxLength rejects messages longer than a number of characters.
+type MaxLength struct {
+	max int
+}
+
+// NewMaxLength creates a filter rejecting messages over max characters. It returns
+// nil if max is not positive.
+func NewMaxLength(max int) *MaxLength {
+	if max <= 0 {
+		return nil
+	}
+	return &MaxLength{max: max}
+}
+
+// Filter implements MessageFilter.
+func (f *MaxLength) Filter(msg Message) Verdict {
+	if utf8.RuneCountInString(msg.Content) <= f.max {
+		return Verdict{}
+	}
+	return Verdict{Action: Reject, Reason: fmt.Sprintf("message is longer than %d characters", f.max)}
+}
@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// RepeatedMessages rejects a sender's message when it repeats their previous
+// messages in the same room too often within a time window. Edits are neither
+// checked nor counted, since correcting a recent message is not spam.
+type RepeatedMessages struct {
+	maxRepeats int
+	window     time.Duration
+	now        func() time.Time
+
+	mu        sync.Mutex
+	last      map[repeatKey]*repeatState
+	lastSweep time.Time
+}
+
+type repeatKey struct {
+	roomID   string
+	senderID string
+}
+
+type repeatState struct {
+	content string
+	count   int
+	first   time.Time
+}
+
+// NewRepeatedMessages creates a filter allowing at most maxRepeats identical messages
+// in a row from a sender within window. It returns nil if maxRepeats is not positive.
+func NewRepeatedMessages(maxRepeats int, window time.Duration) *RepeatedMessages {
+	if maxRepeats <= 0 || window <= 0 {
+		return nil
+	}
+	return &RepeatedMessages{
+		maxRepeats: maxRepeats,
+		window:     window,
+		now:        time.Now,
+		last:       make(map[repeatKey]*repeatState),
+	}
+}
+
+// Filter implements MessageFilter.
+func (f *RepeatedMessages) Filter(msg Message) Verdict {
+	if msg.Edit {
+		return Verdict{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	if now.Sub(f.lastSweep) > f.window {
+		f.expire(now)
+		f.lastSweep = now
+	}
+
+	key := repeatKey{roomID: msg.RoomID, senderID: msg.SenderID}
+	content := strings.ToLower(strings.Join(strings.Fields(msg.Content), " "))
+	state, ok := f.last[key]
+	if !ok || state.content != content || now.Sub(state.first) > f.window {
+		f.last[key] = &repeatState{content: content, count: 1, first: now}
+		return Verdict{}
+	}
+	if state.count >= f.maxRepeats {
+		return Verdict{Action: Reject, Reason: "please do not repeat the same message"}
+	}
+	state.count++
+	return Verdict{}
+}
+
+// expire forgets senders whose repetition window has ended, so that the filter does
+// not keep state for every sender ever seen.
+func (f *RepeatedMessages) expire(now time.Time) {
+	for key, state := range f.last {
+		if now.Sub(state.first) > f.window {
+			delete(f.last, key)
+		}
+	}
+}
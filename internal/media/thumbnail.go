@@ -0,0 +1,122 @@
+// Package media inspects and transforms uploaded images.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // Register the GIF decoder.
+	"image/jpeg"
+	"image/png"
+)
+
+// maxPixels bounds the size of images that are decoded, so that a small compressed
+// file cannot make the server allocate gigabytes of memory.
+const maxPixels = 40_000_000
+
+// ErrImageTooLarge is returned for images with more than maxPixels pixels.
+var ErrImageTooLarge = errors.New("image is too large")
+
+// Thumbnail is a scaled-down copy of an image.
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+
+	// Width and Height are the dimensions of the original image.
+	Width  int
+	Height int
+}
+
+// ImageSize returns the dimensions of a PNG, JPEG or GIF image without decoding it.
+func ImageSize(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read image header: %w", err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// MakeThumbnail scales a PNG, JPEG or GIF image down to fit in a maxSize square.
+// Images with transparency are encoded as PNG and all others as JPEG. Images that
+// already fit are re-encoded at their own size.
+func MakeThumbnail(data []byte, maxSize int) (*Thumbnail, error) {
+	width, height, err := ImageSize(data)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	dst := scale(src, maxSize)
+
+	var buf bytes.Buffer
+	thumb := &Thumbnail{Width: width, Height: height}
+	if isOpaque(dst) {
+		thumb.ContentType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	} else {
+		thumb.ContentType = "image/png"
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	thumb.Data = buf.Bytes()
+	return thumb, nil
+}
+
+// scale resizes an image to fit in a maxSize square, averaging the source pixels that
+// map to each destination pixel.
+func scale(src image.Image, maxSize int) *image.NRGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSize || h > maxSize {
+		if w >= h {
+			w, h = maxSize, max(1, h*maxSize/b.Dx())
+		} else {
+			w, h = max(1, w*maxSize/b.Dy()), maxSize
+		}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if w == b.Dx() && h == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r, g, bl, a = r+uint64(c.R), g+uint64(c.G), bl+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
+
+// isOpaque reports whether every pixel of an image is fully opaque.
+func isOpaque(img *image.NRGBA) bool {
+	for i := 3; i < len(img.Pix); i += 4 {
+		if img.Pix[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
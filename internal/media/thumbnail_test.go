@@ -0,0 +1,145 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func filledImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// withPNGSize rewrites the dimensions in the header of a PNG image, leaving its pixel
+// data alone, as a crafted upload would.
+func withPNGSize(t *testing.T, data []byte, w, h uint32) []byte {
+	t.Helper()
+	out := bytes.Clone(data)
+	// The IHDR chunk follows the 8-byte signature: length, type, then width and height.
+	ihdr := out[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], w)
+	binary.BigEndian.PutUint32(ihdr[4:8], h)
+	binary.BigEndian.PutUint32(out[8+8+13:], crc32.ChecksumIEEE(out[8+4:8+8+13]))
+	return out
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	tests := []struct {
+		name        string
+		img         image.Image
+		maxSize     int
+		contentType string
+		width       int
+		height      int
+	}{
+		{
+			name:        "landscape",
+			img:         filledImage(400, 200, color.NRGBA{R: 200, A: 0xff}),
+			maxSize:     100,
+			contentType: "image/jpeg",
+			width:       100,
+			height:      50,
+		},
+		{
+			name:        "portrait",
+			img:         filledImage(200, 400, color.NRGBA{G: 200, A: 0xff}),
+			maxSize:     100,
+			contentType: "image/jpeg",
+			width:       50,
+			height:      100,
+		},
+		{
+			name:        "transparent",
+			img:         filledImage(300, 300, color.NRGBA{B: 200, A: 0x80}),
+			maxSize:     100,
+			contentType: "image/png",
+			width:       100,
+			height:      100,
+		},
+		{
+			name:        "already small",
+			img:         filledImage(40, 30, color.NRGBA{R: 10, G: 20, B: 30, A: 0xff}),
+			maxSize:     100,
+			contentType: "image/jpeg",
+			width:       40,
+			height:      30,
+		},
+		{
+			name:        "thin",
+			img:         filledImage(1000, 2, color.NRGBA{A: 0xff}),
+			maxSize:     100,
+			contentType: "image/jpeg",
+			width:       100,
+			height:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumb, err := MakeThumbnail(encodePNG(t, tt.img), tt.maxSize)
+			if err != nil {
+				t.Fatalf("MakeThumbnail: %v", err)
+			}
+			if thumb.ContentType != tt.contentType {
+				t.Errorf("ContentType = %q, want %q", thumb.ContentType, tt.contentType)
+			}
+			b := tt.img.Bounds()
+			if thumb.Width != b.Dx() || thumb.Height != b.Dy() {
+				t.Errorf("original size = %dx%d, want %dx%d", thumb.Width, thumb.Height, b.Dx(), b.Dy())
+			}
+			decoded, _, err := image.Decode(bytes.NewReader(thumb.Data))
+			if err != nil {
+				t.Fatalf("thumbnail does not decode: %v", err)
+			}
+			if got := decoded.Bounds(); got.Dx() != tt.width || got.Dy() != tt.height {
+				t.Errorf("thumbnail size = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestMakeThumbnailTooLarge(t *testing.T) {
+	// A tiny file claiming to be 20000x20000 pixels must be refused before decoding.
+	data := withPNGSize(t, encodePNG(t, filledImage(1, 1, color.NRGBA{A: 0xff})), 20000, 20000)
+	if w, h, err := ImageSize(data); err != nil || w != 20000 || h != 20000 {
+		t.Fatalf("ImageSize = %dx%d, %v; want the forged size", w, h, err)
+	}
+	if _, err := MakeThumbnail(data, 100); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("MakeThumbnail error = %v, want ErrImageTooLarge", err)
+	}
+}
+
+func TestMakeThumbnailInvalidInput(t *testing.T) {
+	valid := encodePNG(t, filledImage(10, 10, color.NRGBA{A: 0xff}))
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"text":      []byte("hello, this is not an image"),
+		"truncated": valid[:len(valid)/2],
+		"svg":       []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := MakeThumbnail(data, 100); err == nil {
+				t.Error("MakeThumbnail accepted invalid input")
+			}
+		})
+	}
+}
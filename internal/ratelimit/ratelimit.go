@@ -0,0 +1,165 @@
+// Package ratelimit limits how often, and how many times at once, clients may use the
+// server.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// sweepInterval is how often a KeyedLimiter forgets the keys it no longer limits.
+const sweepInterval = time.Minute
+
+// Rate is a token bucket: PerSecond events per second on average, in bursts of at
+// most Burst events. A Rate with a zero field is unlimited.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Unlimited reports whether the rate lets every event through.
+func (r Rate) Unlimited() bool {
+	return r.PerSecond <= 0 || r.Burst <= 0
+}
+
+// NewLimiter creates a limiter for the rate, or nil if the rate is unlimited.
+func (r Rate) NewLimiter() *rate.Limiter {
+	if r.Unlimited() {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(r.PerSecond), r.Burst)
+}
+
+// Allow reports whether an event may happen now according to lim, taking a token if
+// so. Otherwise it returns how long to wait until the event would be allowed. A nil
+// limiter allows every event.
+func Allow(lim *rate.Limiter) (bool, time.Duration) {
+	if lim == nil {
+		return true, 0
+	}
+	now := time.Now()
+	res := lim.ReserveN(now, 1)
+	if !res.OK() {
+		return false, 0
+	}
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// KeyedLimiter applies a rate to each key, such as an IP address or a username,
+// separately. It is safe for concurrent use, and a nil KeyedLimiter allows every
+// event.
+type KeyedLimiter struct {
+	rate Rate
+
+	mu        sync.Mutex
+	limiters  map[string]*keyedEntry
+	lastSweep time.Time
+}
+
+type keyedEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewKeyedLimiter creates a limiter applying r to each key, or returns nil if r is
+// unlimited.
+func NewKeyedLimiter(r Rate) *KeyedLimiter {
+	if r.Unlimited() {
+		return nil
+	}
+	return &KeyedLimiter{
+		rate:      r,
+		limiters:  make(map[string]*keyedEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether an event for key may happen now. Otherwise it returns how
+// long to wait until the event would be allowed.
+func (l *KeyedLimiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	l.sweep(now)
+	e, ok := l.limiters[key]
+	if !ok {
+		e = &keyedEntry{limiter: l.rate.NewLimiter()}
+		l.limiters[key] = e
+	}
+	e.lastSeen = now
+	l.mu.Unlock()
+
+	return Allow(e.limiter)
+}
+
+// sweep forgets the keys whose bucket has had time to refill completely, since a new
+// limiter would behave the same. It runs at most once per sweepInterval; l.mu must be
+// held.
+func (l *KeyedLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(float64(l.rate.Burst) / l.rate.PerSecond * float64(time.Second))
+	for key, e := range l.limiters {
+		if now.Sub(e.lastSeen) > refill {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+// ConnLimiter bounds the number of concurrent connections per key. It is safe for
+// concurrent use, and a nil ConnLimiter allows any number of connections.
+type ConnLimiter struct {
+	max int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+// NewConnLimiter creates a limiter allowing at most max connections per key, or
+// returns nil if max is not positive.
+func NewConnLimiter(max int) *ConnLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ConnLimiter{max: max, conns: make(map[string]int)}
+}
+
+// Acquire reserves a connection for key and reports whether the key was below its
+// limit. Every successful Acquire must be followed by a Release.
+func (l *ConnLimiter) Acquire(key string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[key] >= l.max {
+		return false
+	}
+	l.conns[key]++
+	return true
+}
+
+// Release frees a connection reserved by Acquire.
+func (l *ConnLimiter) Release(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[key] <= 1 {
+		delete(l.conns, key)
+		return
+	}
+	l.conns[key]--
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// attachmentColumns lists the columns of the attachments table scanned by scanAttachment.
+const attachmentColumns = `id, room_id, uploader_id, file_name, content_type, size, COALESCE(width, 0), COALESCE(height, 0),
+	blob_key, COALESCE(thumbnail_key, ''), created_at`
+
+// SaveAttachment records an uploaded file and populates its creation time.
+func (r *PostgresRepository) SaveAttachment(ctx context.Context, a *domain.Attachment) error {
+	query := `
+		INSERT INTO attachments (id, room_id, uploader_id, file_name, content_type, size, width, height, blob_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, 0), $9, NULLIF($10, ''))
+		RETURNING created_at`
+	err := r.pool.QueryRow(ctx, query, a.ID, a.RoomID, a.UploaderID, a.FileName, a.ContentType, a.Size,
+		a.Width, a.Height, a.BlobKey, a.ThumbnailKey).Scan(&a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save attachment: %w", err)
+	}
+	setAttachmentURLs(a)
+	return nil
+}
+
+// GetAttachment retrieves an uploaded file, or ErrNotFound if it does not exist.
+func (r *PostgresRepository) GetAttachment(ctx context.Context, attachmentID string) (*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1`
+	a, err := scanAttachment(r.pool.QueryRow(ctx, query, attachmentID))
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("attachment %s: %w", attachmentID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachment: %w", err)
+	}
+	return a, nil
+}
+
+// IsRoomMember reports whether a user has ever joined a room.
+func (r *PostgresRepository) IsRoomMember(ctx context.Context, roomID, userID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2)`
+	var member bool
+	if err := r.pool.QueryRow(ctx, query, roomID, userID).Scan(&member); err != nil {
+		return false, fmt.Errorf("failed to query room membership: %w", err)
+	}
+	return member, nil
+}
+
+// getAttachments returns the uploaded files with the given IDs, keyed by ID.
+func (r *PostgresRepository) getAttachments(ctx context.Context, attachmentIDs []string) (map[string]*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = ANY($1)`
+	rows, err := r.pool.Query(ctx, query, attachmentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	attachments := make(map[string]*domain.Attachment)
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment row: %w", err)
+		}
+		attachments[a.ID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate attachment rows: %w", err)
+	}
+	return attachments, nil
+}
+
+// scanAttachment reads a row selected with attachmentColumns.
+func scanAttachment(row pgx.Row) (*domain.Attachment, error) {
+	var a domain.Attachment
+	if err := row.Scan(&a.ID, &a.RoomID, &a.UploaderID, &a.FileName, &a.ContentType, &a.Size, &a.Width, &a.Height,
+		&a.BlobKey, &a.ThumbnailKey, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	setAttachmentURLs(&a)
+	return &a, nil
+}
+
+// setAttachmentURLs fills in the download URLs of an attachment.
+func setAttachmentURLs(a *domain.Attachment) {
+	a.URL = "/api/attachments/" + a.ID
+	a.ThumbnailURL = ""
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveAuditEvents appends events to the audit log in a single batch.
+func (r *PostgresRepository) SaveAuditEvents(ctx context.Context, events []*domain.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (time, type, actor_id, actor_name, room_id, target_id, remote_addr, details)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), $8)`
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		batch.Queue(query, e.Time, e.Type, e.ActorID, e.ActorName, e.RoomID, e.TargetID, e.RemoteAddr, e.Details)
+	}
+	if err := r.pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("failed to save audit events: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEvents retrieves up to q.Limit audit events matching a query, newest first.
+func (r *PostgresRepository) GetAuditEvents(ctx context.Context, q domain.AuditQuery) ([]*domain.AuditEvent, error) {
+	query := `
+		SELECT id, time, type, COALESCE(actor_id, ''), COALESCE(actor_name, ''), COALESCE(room_id, ''),
+			COALESCE(target_id, ''), COALESCE(remote_addr, ''), details
+		FROM audit_events
+		WHERE ($1 = '' OR type = $1)
+			AND ($2 = '' OR actor_id = $2)
+			AND ($3 = '' OR room_id = $3)
+			AND ($4 = '' OR target_id = $4)
+			AND ($5::timestamptz IS NULL OR time >= $5)
+			AND ($6::timestamptz IS NULL OR time < $6)
+			AND ($7 = 0 OR id < $7)
+		ORDER BY id DESC
+		LIMIT $8`
+
+	rows, err := r.pool.Query(ctx, query, q.Type, q.ActorID, q.RoomID, q.TargetID,
+		optionalTime(q.From), optionalTime(q.To), q.BeforeID, q.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*domain.AuditEvent
+	for rows.Next() {
+		var e domain.AuditEvent
+		if err := rows.Scan(&e.ID, &e.Time, &e.Type, &e.ActorID, &e.ActorName, &e.RoomID, &e.TargetID, &e.RemoteAddr, &e.Details); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event row: %w", err)
+		}
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit event rows: %w", err)
+	}
+	return events, nil
+}
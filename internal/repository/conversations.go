@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateConversation creates a group conversation with the given participants and
+// populates its ID, creation time and participant list. It returns ErrNotFound if
+// any of the participants does not exist.
+func (r *PostgresRepository) CreateConversation(ctx context.Context, conv *domain.Conversation, participantIDs []string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	rows, err := tx.Query(ctx, `SELECT id, username FROM users WHERE id = ANY($1) ORDER BY username`, participantIDs)
+	if err != nil {
+		return fmt.Errorf("failed to query participants: %w", err)
+	}
+	participants, err := scanUsers(rows)
+	if err != nil {
+		return err
+	}
+	if len(participants) != len(participantIDs) {
+		return fmt.Errorf("conversation participant: %w", ErrNotFound)
+	}
+
+	conv.ID = uuid.NewString()
+	queryCreate := `INSERT INTO conversations (id, name, created_by) VALUES ($1, $2, $3) RETURNING created_at`
+	if err := tx.QueryRow(ctx, queryCreate, conv.ID, conv.Name, conv.CreatedBy).Scan(&conv.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	queryMembers := `INSERT INTO conversation_members (conversation_id, user_id) SELECT $1, unnest($2::varchar[])`
+	if _, err := tx.Exec(ctx, queryMembers, conv.ID, participantIDs); err != nil {
+		return fmt.Errorf("failed to add conversation members: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit conversation: %w", err)
+	}
+	conv.Participants = participants
+	return nil
+}
+
+// GetConversationsForUser lists the group conversations a user participates in,
+// most recently created first.
+func (r *PostgresRepository) GetConversationsForUser(ctx context.Context, userID string) ([]*domain.Conversation, error) {
+	query := `
+		SELECT c.id, c.name, c.created_by, c.created_at
+		FROM conversations c
+		JOIN conversation_members m ON m.conversation_id = c.id
+		WHERE m.user_id = $1
+		ORDER BY c.created_at DESC`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []*domain.Conversation
+	for rows.Next() {
+		var conv domain.Conversation
+		if err := rows.Scan(&conv.ID, &conv.Name, &conv.CreatedBy, &conv.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation row: %w", err)
+		}
+		conversations = append(conversations, &conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate conversation rows: %w", err)
+	}
+	rows.Close()
+
+	for _, conv := range conversations {
+		if conv.Participants, err = r.getConversationParticipants(ctx, conv.ID); err != nil {
+			return nil, err
+		}
+	}
+	return conversations, nil
+}
+
+// GetConversationMemberIDs returns the IDs of the participants of a conversation, or
+// ErrNotFound if the conversation does not exist.
+func (r *PostgresRepository) GetConversationMemberIDs(ctx context.Context, conversationID string) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `SELECT user_id FROM conversation_members WHERE conversation_id = $1`, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation members: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation member row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate conversation member rows: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("conversation %s: %w", conversationID, ErrNotFound)
+	}
+	return ids, nil
+}
+
+// SaveGroupMessage stores a group conversation message and populates its ID and
+// timestamp. It returns ErrDuplicateMessage if the sender already submitted a message
+// with the same client message ID, in which case gm describes the stored copy.
+func (r *PostgresRepository) SaveGroupMessage(ctx context.Context, gm *domain.GroupMessage) error {
+	query := `
+		INSERT INTO group_messages (conversation_id, sender_id, content, client_msg_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (sender_id, client_msg_id) DO NOTHING
+		RETURNING id, timestamp`
+	err := r.pool.QueryRow(ctx, query, gm.ConversationID, gm.SenderID, gm.Content, gm.ClientMsgID).Scan(&gm.ID, &gm.Timestamp)
+	if err == pgx.ErrNoRows {
+		queryExisting := `SELECT id, timestamp FROM group_messages WHERE sender_id = $1 AND client_msg_id = $2`
+		if err := r.pool.QueryRow(ctx, queryExisting, gm.SenderID, gm.ClientMsgID).Scan(&gm.ID, &gm.Timestamp); err != nil {
+			return fmt.Errorf("failed to load duplicate group message: %w", err)
+		}
+		return ErrDuplicateMessage
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save group message: %w", err)
+	}
+	return nil
+}
+
+// GetGroupMessages retrieves up to limit messages of a conversation with an ID lower
+// than beforeID (or the most recent ones if beforeID is 0), oldest first.
+func (r *PostgresRepository) GetGroupMessages(ctx context.Context, conversationID string, beforeID int64, limit int) ([]*domain.GroupMessage, error) {
+	query := `
+		SELECT g.id, g.conversation_id, g.sender_id, COALESCE(u.username, ''), g.content, COALESCE(g.client_msg_id, ''), g.timestamp
+		FROM group_messages g
+		LEFT JOIN users u ON u.id = g.sender_id
+		WHERE g.conversation_id = $1 AND ($2 = 0 OR g.id < $2)
+		ORDER BY g.id DESC
+		LIMIT $3`
+
+	rows, err := r.pool.Query(ctx, query, conversationID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []*domain.GroupMessage
+	for rows.Next() {
+		var gm domain.GroupMessage
+		if err := rows.Scan(&gm.ID, &gm.ConversationID, &gm.SenderID, &gm.SenderName, &gm.Content, &gm.ClientMsgID, &gm.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan group message row: %w", err)
+		}
+		messages = append(messages, &gm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate group message rows: %w", err)
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// getConversationParticipants returns the users participating in a conversation.
+func (r *PostgresRepository) getConversationParticipants(ctx context.Context, conversationID string) ([]*domain.User, error) {
+	query := `
+		SELECT u.id, u.username
+		FROM conversation_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.conversation_id = $1
+		ORDER BY u.username`
+
+	rows, err := r.pool.Query(ctx, query, conversationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation participants: %w", err)
+	}
+	return scanUsers(rows)
+}
+
+// scanUsers reads rows selected as (id, username) and closes them.
+func scanUsers(rows pgx.Rows) ([]*domain.User, error) {
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		var user domain.User
+		if err := rows.Scan(&user.ID, &user.UserName); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate user rows: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// directMessageColumns lists the columns scanned by scanDirectMessages.
+const directMessageColumns = `d.id, d.sender_id, COALESCE(u.username, ''), d.recipient_id, d.content, COALESCE(d.client_msg_id, ''), d.timestamp, d.delivered_at`
+
+// SaveDirectMessage stores a direct message and populates its ID and timestamp.
+// It returns ErrDuplicateMessage if the sender already submitted a message with the
+// same client message ID, in which case dm describes the stored copy.
+func (r *PostgresRepository) SaveDirectMessage(ctx context.Context, dm *domain.DirectMessage) error {
+	query := `
+		INSERT INTO direct_messages (sender_id, recipient_id, content, client_msg_id)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (sender_id, client_msg_id) DO NOTHING
+		RETURNING id, timestamp`
+	err := r.pool.QueryRow(ctx, query, dm.SenderID, dm.RecipientID, dm.Content, dm.ClientMsgID).Scan(&dm.ID, &dm.Timestamp)
+	if err == pgx.ErrNoRows {
+		queryExisting := `SELECT id, timestamp, delivered_at FROM direct_messages WHERE sender_id = $1 AND client_msg_id = $2`
+		if err := r.pool.QueryRow(ctx, queryExisting, dm.SenderID, dm.ClientMsgID).Scan(&dm.ID, &dm.Timestamp, &dm.DeliveredAt); err != nil {
+			return fmt.Errorf("failed to load duplicate direct message: %w", err)
+		}
+		return ErrDuplicateMessage
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save direct message: %w", err)
+	}
+	return nil
+}
+
+// MarkDirectMessagesDelivered records that the given direct messages reached their recipient.
+func (r *PostgresRepository) MarkDirectMessagesDelivered(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query := `UPDATE direct_messages SET delivered_at = NOW() WHERE id = ANY($1) AND delivered_at IS NULL`
+	if _, err := r.pool.Exec(ctx, query, ids); err != nil {
+		return fmt.Errorf("failed to mark direct messages delivered: %w", err)
+	}
+	return nil
+}
+
+// GetPendingDirectMessages retrieves up to limit undelivered direct messages for a user, oldest first.
+func (r *PostgresRepository) GetPendingDirectMessages(ctx context.Context, recipientID string, limit int) ([]*domain.DirectMessage, error) {
+	query := `
+		SELECT ` + directMessageColumns + `
+		FROM direct_messages d
+		LEFT JOIN users u ON u.id = d.sender_id
+		WHERE d.recipient_id = $1 AND d.delivered_at IS NULL
+		ORDER BY d.id ASC
+		LIMIT $2`
+
+	rows, err := r.pool.Query(ctx, query, recipientID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending direct messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDirectMessages(rows)
+}
+
+// GetDirectMessages retrieves up to limit messages exchanged between two users with an
+// ID lower than beforeID (or the most recent ones if beforeID is 0), oldest first.
+func (r *PostgresRepository) GetDirectMessages(ctx context.Context, userID, peerID string, beforeID int64, limit int) ([]*domain.DirectMessage, error) {
+	query := `
+		SELECT ` + directMessageColumns + `
+		FROM direct_messages d
+		LEFT JOIN users u ON u.id = d.sender_id
+		WHERE ((d.sender_id = $1 AND d.recipient_id = $2) OR (d.sender_id = $2 AND d.recipient_id = $1))
+			AND ($3 = 0 OR d.id < $3)
+		ORDER BY d.id DESC
+		LIMIT $4`
+
+	rows, err := r.pool.Query(ctx, query, userID, peerID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query direct messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanDirectMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	return messages, nil
+}
+
+// GetDirectConversations lists the conversations of a user, most recently active first.
+func (r *PostgresRepository) GetDirectConversations(ctx context.Context, userID string) ([]*domain.DirectConversation, error) {
+	query := `
+		WITH latest AS (
+			SELECT DISTINCT ON (peer_id) peer_id, id
+			FROM (
+				SELECT CASE WHEN sender_id = $1 THEN recipient_id ELSE sender_id END AS peer_id, id
+				FROM direct_messages
+				WHERE sender_id = $1 OR recipient_id = $1
+			) conversations
+			ORDER BY peer_id, id DESC
+		)
+		SELECT l.peer_id, COALESCE(p.username, ''), ` + directMessageColumns + `,
+			(SELECT COUNT(*) FROM direct_messages un
+			 WHERE un.sender_id = l.peer_id AND un.recipient_id = $1 AND un.id > COALESCE(rd.last_read_id, 0))
+		FROM latest l
+		JOIN direct_messages d ON d.id = l.id
+		LEFT JOIN users u ON u.id = d.sender_id
+		LEFT JOIN users p ON p.id = l.peer_id
+		LEFT JOIN direct_message_reads rd ON rd.user_id = $1 AND rd.peer_id = l.peer_id
+		ORDER BY d.id DESC`
+
+	rows, err := r.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query direct conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []*domain.DirectConversation
+	for rows.Next() {
+		var conv domain.DirectConversation
+		var dm domain.DirectMessage
+		if err := rows.Scan(&conv.PeerID, &conv.PeerName,
+			&dm.ID, &dm.SenderID, &dm.SenderName, &dm.RecipientID, &dm.Content, &dm.ClientMsgID, &dm.Timestamp, &dm.DeliveredAt,
+			&conv.UnreadCount); err != nil {
+			return nil, fmt.Errorf("failed to scan direct conversation row: %w", err)
+		}
+		conv.LastMessage = &dm
+		conversations = append(conversations, &conv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate direct conversation rows: %w", err)
+	}
+
+	return conversations, nil
+}
+
+// MarkDirectConversationRead moves the read pointer of a user's conversation with a
+// peer forward to lastReadID. The pointer never moves backwards.
+func (r *PostgresRepository) MarkDirectConversationRead(ctx context.Context, userID, peerID string, lastReadID int64) error {
+	query := `
+		INSERT INTO direct_message_reads (user_id, peer_id, last_read_id, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id, peer_id) DO UPDATE
+		SET last_read_id = GREATEST(direct_message_reads.last_read_id, EXCLUDED.last_read_id), updated_at = NOW()`
+	if _, err := r.pool.Exec(ctx, query, userID, peerID, lastReadID); err != nil {
+		return fmt.Errorf("failed to mark direct conversation read: %w", err)
+	}
+	return nil
+}
+
+// scanDirectMessages reads rows selected with directMessageColumns.
+func scanDirectMessages(rows pgx.Rows) ([]*domain.DirectMessage, error) {
+	var messages []*domain.DirectMessage
+	for rows.Next() {
+		var dm domain.DirectMessage
+		if err := rows.Scan(&dm.ID, &dm.SenderID, &dm.SenderName, &dm.RecipientID, &dm.Content, &dm.ClientMsgID, &dm.Timestamp, &dm.DeliveredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan direct message row: %w", err)
+		}
+		messages = append(messages, &dm)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate direct message rows: %w", err)
+	}
+	return messages, nil
+}
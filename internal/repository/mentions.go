@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// SaveMentions records that a chat message mentioned the given users.
+func (r *PostgresRepository) SaveMentions(ctx context.Context, messageID int64, roomID string, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	query := `
+		INSERT INTO message_mentions (message_id, user_id, room_id)
+		SELECT $1, unnest($2::varchar[]), $3
+		ON CONFLICT (message_id, user_id) DO NOTHING`
+	if _, err := r.pool.Exec(ctx, query, messageID, userIDs, roomID); err != nil {
+		return fmt.Errorf("failed to save mentions: %w", err)
+	}
+	return nil
+}
+
+// ReplaceMentions records that an edited chat message now mentions exactly the given
+// users. Mentions of other users are removed, and the mentions the message already
+// had keep their read state. It returns the users who were not mentioned before.
+func (r *PostgresRepository) ReplaceMentions(ctx context.Context, messageID int64, roomID string, userIDs []string) ([]string, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	queryDelete := `DELETE FROM message_mentions WHERE message_id = $1 AND NOT (user_id = ANY($2::varchar[]))`
+	if _, err := tx.Exec(ctx, queryDelete, messageID, userIDs); err != nil {
+		return nil, fmt.Errorf("failed to remove mentions: %w", err)
+	}
+
+	queryInsert := `
+		INSERT INTO message_mentions (message_id, user_id, room_id)
+		SELECT $1, unnest($2::varchar[]), $3
+		ON CONFLICT (message_id, user_id) DO NOTHING
+		RETURNING user_id`
+	rows, err := tx.Query(ctx, queryInsert, messageID, userIDs, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save mentions: %w", err)
+	}
+	var added []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan mention row: %w", err)
+		}
+		added = append(added, userID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate mention rows: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit mentions: %w", err)
+	}
+	return added, nil
+}
+
+// GetUnreadMentions retrieves up to limit unread mentions of a user, newest first.
+// Mentions in messages that were deleted since are skipped.
+func (r *PostgresRepository) GetUnreadMentions(ctx context.Context, userID string, limit int) ([]*domain.Mention, error) {
+	query := `
+		SELECT mm.message_id, mm.room_id, m.sender_id, COALESCE(u.username, ''), m.payload, m.timestamp, mm.read_at
+		FROM message_mentions mm
+		JOIN messages m ON m.id = mm.message_id
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE mm.user_id = $1 AND mm.read_at IS NULL AND m.deleted_at IS NULL
+		ORDER BY mm.message_id DESC
+		LIMIT $2`
+
+	rows, err := r.pool.Query(ctx, query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []*domain.Mention
+	for rows.Next() {
+		var mention domain.Mention
+		if err := rows.Scan(&mention.MessageID, &mention.RoomID, &mention.SenderID, &mention.SenderName, &mention.Content, &mention.Timestamp, &mention.ReadAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mention row: %w", err)
+		}
+		mentions = append(mentions, &mention)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate mention rows: %w", err)
+	}
+	return mentions, nil
+}
+
+// MarkMentionsRead marks the given mentions of a user as read, or all of them when
+// messageIDs is empty.
+func (r *PostgresRepository) MarkMentionsRead(ctx context.Context, userID string, messageIDs []int64) error {
+	query := `
+		UPDATE message_mentions SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL AND (cardinality($2::int8[]) = 0 OR message_id = ANY($2))`
+	if messageIDs == nil {
+		messageIDs = []int64{}
+	}
+	if _, err := r.pool.Exec(ctx, query, userID, messageIDs); err != nil {
+		return fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+	return nil
+}
+
+// getMentionsForMessages returns the IDs of the users mentioned in several messages,
+// keyed by message ID.
+func (r *PostgresRepository) getMentionsForMessages(ctx context.Context, messageIDs []int64) (map[int64][]string, error) {
+	query := `
+		SELECT message_id, array_agg(user_id ORDER BY user_id)
+		FROM message_mentions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id`
+
+	rows, err := r.pool.Query(ctx, query, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mentions: %w", err)
+	}
+	defer rows.Close()
+
+	mentions := make(map[int64][]string)
+	for rows.Next() {
+		var messageID int64
+		var userIDs []string
+		if err := rows.Scan(&messageID, &userIDs); err != nil {
+			return nil, fmt.Errorf("failed to scan mention row: %w", err)
+		}
+		mentions[messageID] = userIDs
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate mention rows: %w", err)
+	}
+	return mentions, nil
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// BanUser bans a user from a room. Banning a user again updates the reason.
+func (r *PostgresRepository) BanUser(ctx context.Context, roomID, userID, bannedBy, reason string) error {
+	query := `
+		INSERT INTO room_bans (room_id, user_id, banned_by, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET banned_by = EXCLUDED.banned_by, reason = EXCLUDED.reason, created_at = NOW()`
+	if _, err := r.pool.Exec(ctx, query, roomID, userID, bannedBy, reason); err != nil {
+		return fmt.Errorf("failed to ban user: %w", err)
+	}
+	return nil
+}
+
+// UnbanUser lifts the ban of a user from a room and reports whether they were banned.
+func (r *PostgresRepository) UnbanUser(ctx context.Context, roomID, userID string) (bool, error) {
+	query := `DELETE FROM room_bans WHERE room_id = $1 AND user_id = $2`
+	tag, err := r.pool.Exec(ctx, query, roomID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unban user: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// IsBanned reports whether a user is banned from a room.
+func (r *PostgresRepository) IsBanned(ctx context.Context, roomID, userID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM room_bans WHERE room_id = $1 AND user_id = $2)`
+	var banned bool
+	if err := r.pool.QueryRow(ctx, query, roomID, userID).Scan(&banned); err != nil {
+		return false, fmt.Errorf("failed to query room ban: %w", err)
+	}
+	return banned, nil
+}
+
+// MuteUser mutes a user in a room until the given time, replacing any earlier mute.
+func (r *PostgresRepository) MuteUser(ctx context.Context, roomID, userID, mutedBy, reason string, until time.Time) error {
+	query := `
+		INSERT INTO room_mutes (room_id, user_id, muted_by, reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET muted_by = EXCLUDED.muted_by, reason = EXCLUDED.reason, expires_at = EXCLUDED.expires_at, created_at = NOW()`
+	if _, err := r.pool.Exec(ctx, query, roomID, userID, mutedBy, reason, until); err != nil {
+		return fmt.Errorf("failed to mute user: %w", err)
+	}
+	return nil
+}
+
+// UnmuteUser lifts the mute of a user in a room and reports whether they were muted.
+func (r *PostgresRepository) UnmuteUser(ctx context.Context, roomID, userID string) (bool, error) {
+	query := `DELETE FROM room_mutes WHERE room_id = $1 AND user_id = $2 AND expires_at > NOW()`
+	tag, err := r.pool.Exec(ctx, query, roomID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmute user: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetMuteExpiry returns when the mute of a user in a room ends, or the zero time if
+// the user is not muted.
+func (r *PostgresRepository) GetMuteExpiry(ctx context.Context, roomID, userID string) (time.Time, error) {
+	query := `SELECT expires_at FROM room_mutes WHERE room_id = $1 AND user_id = $2 AND expires_at > NOW()`
+	var expiresAt time.Time
+	err := r.pool.QueryRow(ctx, query, roomID, userID).Scan(&expiresAt)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query room mute: %w", err)
+	}
+	return expiresAt, nil
+}
+
+// RecordModerationAction appends a moderation command to the audit trail of its room
+// and populates its creation time.
+func (r *PostgresRepository) RecordModerationAction(ctx context.Context, action *domain.ModerationAction) error {
+	query := `
+		INSERT INTO moderation_actions (room_id, action, user_id, moderator_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`
+	err := r.pool.QueryRow(ctx, query, action.RoomID, action.Action, action.UserID, action.ModeratorID, action.Reason, action.ExpiresAt).
+		Scan(&action.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record moderation action: %w", err)
+	}
+	return nil
+}
+
+// FlagMessage records the reasons the content filters flagged a chat message for.
+func (r *PostgresRepository) FlagMessage(ctx context.Context, messageID int64, reasons []string) error {
+	query := `
+		INSERT INTO message_flags (message_id, reason)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (message_id, reason) DO NOTHING`
+	if _, err := r.pool.Exec(ctx, query, messageID, reasons); err != nil {
+		return fmt.Errorf("failed to flag message: %w", err)
+	}
+	return nil
+}
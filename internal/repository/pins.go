@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// PinMessage pins a chat message to its room. Pinning a message twice has no effect.
+func (r *PostgresRepository) PinMessage(ctx context.Context, roomID string, messageID int64, userID string) error {
+	query := `
+		INSERT INTO pinned_messages (room_id, message_id, pinned_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id) DO NOTHING`
+	if _, err := r.pool.Exec(ctx, query, roomID, messageID, userID); err != nil {
+		return fmt.Errorf("failed to pin message: %w", err)
+	}
+	return nil
+}
+
+// UnpinMessage removes the pin of a chat message and reports whether it was pinned.
+func (r *PostgresRepository) UnpinMessage(ctx context.Context, roomID string, messageID int64) (bool, error) {
+	query := `DELETE FROM pinned_messages WHERE room_id = $1 AND message_id = $2`
+	tag, err := r.pool.Exec(ctx, query, roomID, messageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin message: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// CountPinnedMessages returns the number of messages pinned to a room.
+func (r *PostgresRepository) CountPinnedMessages(ctx context.Context, roomID string) (int, error) {
+	query := `SELECT COUNT(*) FROM pinned_messages WHERE room_id = $1`
+	var count int
+	if err := r.pool.QueryRow(ctx, query, roomID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pinned messages: %w", err)
+	}
+	return count, nil
+}
+
+// GetPinnedMessages retrieves the pinned messages of a room, oldest pin first. Pins of
+// messages that were deleted since are skipped.
+func (r *PostgresRepository) GetPinnedMessages(ctx context.Context, roomID string) ([]*domain.PinnedMessage, error) {
+	query := `
+		SELECT ` + messageColumns + `, p.pinned_by, p.pinned_at
+		FROM pinned_messages p
+		JOIN messages m ON m.id = p.message_id
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE p.room_id = $1 AND m.deleted_at IS NULL
+		ORDER BY p.pinned_at, p.message_id`
+
+	rows, err := r.pool.Query(ctx, query, roomID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pinned messages: %w", err)
+	}
+	defer rows.Close()
+
+	pins := []*domain.PinnedMessage{}
+	var messages []*domain.Message
+	for rows.Next() {
+		var pin domain.PinnedMessage
+		msg, err := scanMessage(rows, "text_message", &pin.PinnedBy, &pin.PinnedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pinned message row: %w", err)
+		}
+		pin.Message = msg
+		pins = append(pins, &pin)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate pinned message rows: %w", err)
+	}
+	if err := r.attachMessageDetails(ctx, messages); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// AddReaction adds a user's emoji reaction to a message. Adding the same reaction
+// twice has no effect.
+func (r *PostgresRepository) AddReaction(ctx context.Context, messageID int64, userID, emoji string) error {
+	query := `
+		INSERT INTO message_reactions (message_id, user_id, emoji)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING`
+	if _, err := r.pool.Exec(ctx, query, messageID, userID, emoji); err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveReaction removes a user's emoji reaction from a message, if present.
+func (r *PostgresRepository) RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) error {
+	query := `DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3`
+	if _, err := r.pool.Exec(ctx, query, messageID, userID, emoji); err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return nil
+}
+
+// GetReactions returns the aggregated reactions on a message.
+func (r *PostgresRepository) GetReactions(ctx context.Context, messageID int64) ([]domain.ReactionSummary, error) {
+	byMessage, err := r.getReactionsForMessages(ctx, []int64{messageID})
+	if err != nil {
+		return nil, err
+	}
+	reactions := byMessage[messageID]
+	if reactions == nil {
+		reactions = []domain.ReactionSummary{}
+	}
+	return reactions, nil
+}
+
+// getReactionsForMessages returns the aggregated reactions on several messages, keyed
+// by message ID. Emojis are ordered by when they were first used on each message.
+func (r *PostgresRepository) getReactionsForMessages(ctx context.Context, messageIDs []int64) (map[int64][]domain.ReactionSummary, error) {
+	query := `
+		SELECT message_id, emoji, COUNT(*), array_agg(user_id ORDER BY created_at)
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)`
+
+	rows, err := r.pool.Query(ctx, query, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reactions: %w", err)
+	}
+	defer rows.Close()
+
+	reactions := make(map[int64][]domain.ReactionSummary)
+	for rows.Next() {
+		var messageID int64
+		var summary domain.ReactionSummary
+		if err := rows.Scan(&messageID, &summary.Emoji, &summary.Count, &summary.UserIDs); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction row: %w", err)
+		}
+		reactions[messageID] = append(reactions[messageID], summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate reaction rows: %w", err)
+	}
+	return reactions, nil
+}
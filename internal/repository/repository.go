@@ -3,7 +3,9 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/Lec7ral/WithWebSocket/internal/domain"
@@ -12,6 +14,14 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ErrDuplicateMessage is returned by SaveMessage when the sender already submitted a
+// message with the same client message ID. The message is still populated with the
+// ID and timestamp of the originally stored copy.
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
 // Repository defines the interface for database operations.
 type Repository interface {
 	SaveMessage(ctx context.Context, msg *domain.Message) error
@@ -20,6 +30,55 @@ type Repository interface {
 	GetWhiteboardState(ctx context.Context, roomID string) (*domain.WhiteboardState, error)
 	SaveWhiteboardState(ctx context.Context, roomID string, state *domain.WhiteboardState) error
 	FindUserByID(ctx context.Context, userID string) (*domain.User, error) // New method
+	GetRoomSeq(ctx context.Context, roomID string) (int64, error)
+	ReserveRoomSeqs(ctx context.Context, roomID string, n int64) (int64, error)
+	GetMessagesSince(ctx context.Context, roomID string, seq int64, limit int) ([]*domain.Message, error)
+	GetMessageByID(ctx context.Context, messageID int64) (*domain.Message, error)
+	GetMessageIDByClientMsgID(ctx context.Context, senderID, clientMsgID string) (int64, time.Time, error)
+	GetThreadReplies(ctx context.Context, parentID int64, beforeID int64, limit int) ([]*domain.Message, error)
+	AddReaction(ctx context.Context, messageID int64, userID, emoji string) error
+	RemoveReaction(ctx context.Context, messageID int64, userID, emoji string) error
+	GetReactions(ctx context.Context, messageID int64) ([]domain.ReactionSummary, error)
+	EditMessage(ctx context.Context, messageID int64, editorID, content, html string) (time.Time, error)
+	DeleteMessage(ctx context.Context, messageID int64, deletedBy string) (time.Time, error)
+	EnsureRoom(ctx context.Context, roomID, userID string) error
+	GetRoomRole(ctx context.Context, roomID, userID string) (string, error)
+	SetRoomRole(ctx context.Context, roomID, userID, role, grantedBy string) error
+	AddRoomMember(ctx context.Context, roomID, userID string) error
+	FindRoomMembersByUsernames(ctx context.Context, roomID string, usernames []string) ([]*domain.User, error)
+	SaveAttachment(ctx context.Context, a *domain.Attachment) error
+	GetAttachment(ctx context.Context, attachmentID string) (*domain.Attachment, error)
+	IsRoomMember(ctx context.Context, roomID, userID string) (bool, error)
+	PinMessage(ctx context.Context, roomID string, messageID int64, userID string) error
+	UnpinMessage(ctx context.Context, roomID string, messageID int64) (bool, error)
+	CountPinnedMessages(ctx context.Context, roomID string) (int, error)
+	GetPinnedMessages(ctx context.Context, roomID string) ([]*domain.PinnedMessage, error)
+	BanUser(ctx context.Context, roomID, userID, bannedBy, reason string) error
+	UnbanUser(ctx context.Context, roomID, userID string) (bool, error)
+	IsBanned(ctx context.Context, roomID, userID string) (bool, error)
+	MuteUser(ctx context.Context, roomID, userID, mutedBy, reason string, until time.Time) error
+	UnmuteUser(ctx context.Context, roomID, userID string) (bool, error)
+	GetMuteExpiry(ctx context.Context, roomID, userID string) (time.Time, error)
+	RecordModerationAction(ctx context.Context, action *domain.ModerationAction) error
+	FlagMessage(ctx context.Context, messageID int64, reasons []string) error
+	SaveAuditEvents(ctx context.Context, events []*domain.AuditEvent) error
+	GetAuditEvents(ctx context.Context, q domain.AuditQuery) ([]*domain.AuditEvent, error)
+	SearchMessages(ctx context.Context, q domain.SearchQuery) ([]*domain.SearchHit, error)
+	SaveMentions(ctx context.Context, messageID int64, roomID string, userIDs []string) error
+	ReplaceMentions(ctx context.Context, messageID int64, roomID string, userIDs []string) ([]string, error)
+	GetUnreadMentions(ctx context.Context, userID string, limit int) ([]*domain.Mention, error)
+	MarkMentionsRead(ctx context.Context, userID string, messageIDs []int64) error
+	SaveDirectMessage(ctx context.Context, dm *domain.DirectMessage) error
+	MarkDirectMessagesDelivered(ctx context.Context, ids []int64) error
+	GetPendingDirectMessages(ctx context.Context, recipientID string, limit int) ([]*domain.DirectMessage, error)
+	GetDirectMessages(ctx context.Context, userID, peerID string, beforeID int64, limit int) ([]*domain.DirectMessage, error)
+	GetDirectConversations(ctx context.Context, userID string) ([]*domain.DirectConversation, error)
+	MarkDirectConversationRead(ctx context.Context, userID, peerID string, lastReadID int64) error
+	CreateConversation(ctx context.Context, conv *domain.Conversation, participantIDs []string) error
+	GetConversationsForUser(ctx context.Context, userID string) ([]*domain.Conversation, error)
+	GetConversationMemberIDs(ctx context.Context, conversationID string) ([]string, error)
+	SaveGroupMessage(ctx context.Context, gm *domain.GroupMessage) error
+	GetGroupMessages(ctx context.Context, conversationID string, beforeID int64, limit int) ([]*domain.GroupMessage, error)
 	Close()
 }
 
@@ -46,30 +105,56 @@ func (r *PostgresRepository) Close() {
 	r.pool.Close()
 }
 
-// SaveMessage saves a message to the database.
+// SaveMessage saves a chat message, with its attachment if it has one, to the
+// database and populates its ID and timestamp.
 func (r *PostgresRepository) SaveMessage(ctx context.Context, msg *domain.Message) error {
-	if msg.Type != "text_message" {
+	if msg.Type != "text_message" && msg.Type != "attachment" {
 		return nil
 	}
 	payloadStr, ok := msg.Payload.(string)
 	if !ok {
-		return fmt.Errorf("invalid payload type for text_message")
+		return fmt.Errorf("invalid payload type for %s", msg.Type)
+	}
+	var attachmentID string
+	if msg.Attachment != nil {
+		attachmentID = msg.Attachment.ID
+	}
+	// Replies also bump the reply count of their parent in the same statement.
+	query := `
+		WITH inserted AS (
+			INSERT INTO messages (room_id, sender_id, payload, content_html, client_msg_id, seq, parent_id, attachment_id)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, ''))
+			ON CONFLICT (sender_id, client_msg_id) DO NOTHING
+			RETURNING id, timestamp, parent_id
+		), parent AS (
+			UPDATE messages SET reply_count = reply_count + 1, last_reply_at = inserted.timestamp
+			FROM inserted
+			WHERE messages.id = inserted.parent_id
+		)
+		SELECT id, timestamp FROM inserted`
+	err := r.pool.QueryRow(ctx, query, msg.RoomID, msg.Sender, payloadStr, msg.HTML, msg.ClientMsgID, msg.Seq, msg.ParentID, attachmentID).Scan(&msg.ID, &msg.Timestamp)
+	if err == pgx.ErrNoRows {
+		// The insert was skipped because of the unique client_msg_id constraint.
+		queryExisting := `SELECT id, timestamp FROM messages WHERE sender_id = $1 AND client_msg_id = $2`
+		if err := r.pool.QueryRow(ctx, queryExisting, msg.Sender, msg.ClientMsgID).Scan(&msg.ID, &msg.Timestamp); err != nil {
+			return fmt.Errorf("failed to load duplicate message: %w", err)
+		}
+		return ErrDuplicateMessage
 	}
-	query := `INSERT INTO messages (room_id, sender_id, payload) VALUES ($1, $2, $3)`
-	_, err := r.pool.Exec(ctx, query, msg.RoomID, msg.Sender, payloadStr)
 	if err != nil {
 		return fmt.Errorf("failed to save message: %w", err)
 	}
 	return nil
 }
 
-// GetMessagesByRoom retrieves the last N messages for a given room.
+// GetMessagesByRoom retrieves the last N messages for a given room, oldest first.
 func (r *PostgresRepository) GetMessagesByRoom(ctx context.Context, roomID string, limit int) ([]*domain.Message, error) {
 	query := `
-		SELECT room_id, sender_id, payload, timestamp
-		FROM messages
-		WHERE room_id = $1
-		ORDER BY timestamp DESC
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.room_id = $1
+		ORDER BY m.timestamp DESC, m.id DESC
 		LIMIT $2`
 
 	rows, err := r.pool.Query(ctx, query, roomID, limit)
@@ -78,15 +163,12 @@ func (r *PostgresRepository) GetMessagesByRoom(ctx context.Context, roomID strin
 	}
 	defer rows.Close()
 
-	var messages []*domain.Message
-	for rows.Next() {
-		var msg domain.Message
-		var timestamp time.Time
-		if err := rows.Scan(&msg.RoomID, &msg.Sender, &msg.Payload, &timestamp); err != nil {
-			return nil, fmt.Errorf("failed to scan message row: %w", err)
-		}
-		msg.Type = "archived_text_message"
-		messages = append(messages, &msg)
+	messages, err := scanMessages(rows, "archived_text_message")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.attachMessageDetails(ctx, messages); err != nil {
+		return nil, err
 	}
 
 	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
@@ -96,6 +178,52 @@ func (r *PostgresRepository) GetMessagesByRoom(ctx context.Context, roomID strin
 	return messages, nil
 }
 
+// messageColumns lists the columns of the messages table (aliased m, joined with the
+// sender as u) scanned by scanMessage.
+const messageColumns = `m.id, m.room_id, m.sender_id, COALESCE(u.username, ''), m.payload, COALESCE(m.content_html, ''), m.timestamp, COALESCE(m.seq, 0), m.edited_at, m.deleted_at IS NOT NULL,
+	COALESCE(m.parent_id, 0), m.reply_count, m.last_reply_at, COALESCE(m.attachment_id, '')`
+
+// scanMessage reads a row selected with messageColumns into a message of the given
+// type, or of the matching attachment type for messages sharing a file. Only the ID
+// of the attachment is read; attachMessageDetails loads the rest. Columns selected
+// after messageColumns are scanned into extra. Deleted messages keep their metadata
+// but lose their content.
+func scanMessage(row pgx.Row, msgType string, extra ...any) (*domain.Message, error) {
+	var msg domain.Message
+	var payload, attachmentID string
+	dest := []any{&msg.ID, &msg.RoomID, &msg.Sender, &msg.SenderName, &payload, &msg.HTML, &msg.Timestamp, &msg.Seq, &msg.EditedAt, &msg.Deleted,
+		&msg.ParentID, &msg.ReplyCount, &msg.LastReplyAt, &attachmentID}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	msg.Type = msgType
+	if attachmentID != "" {
+		msg.Type = strings.Replace(msgType, "text_message", "attachment", 1)
+		msg.Attachment = &domain.Attachment{ID: attachmentID}
+	}
+	if msg.Deleted {
+		payload, msg.HTML, msg.Attachment = "", "", nil
+	}
+	msg.Payload = payload
+	return &msg, nil
+}
+
+// scanMessages reads rows selected with messageColumns into messages of the given type.
+func scanMessages(rows pgx.Rows, msgType string) ([]*domain.Message, error) {
+	var messages []*domain.Message
+	for rows.Next() {
+		msg, err := scanMessage(rows, msgType)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message row: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate message rows: %w", err)
+	}
+	return messages, nil
+}
+
 // FindOrCreateUserByUsername finds a user by username or creates a new one.
 func (r *PostgresRepository) FindOrCreateUserByUsername(ctx context.Context, username string) (*domain.User, error) {
 	queryFind := `SELECT id, username FROM users WHERE username = $1`
@@ -169,7 +297,7 @@ func (r *PostgresRepository) FindUserByID(ctx context.Context, userID string) (*
 	err := r.pool.QueryRow(ctx, query, userID).Scan(&user.ID, &user.UserName)
 
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("user with ID %s not found", userID)
+		return nil, fmt.Errorf("user with ID %s: %w", userID, ErrNotFound)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user by ID: %w", err)
@@ -177,3 +305,230 @@ func (r *PostgresRepository) FindUserByID(ctx context.Context, userID string) (*
 
 	return &user, nil
 }
+
+// GetRoomSeq returns the highest sequence number reserved for the events of a room or
+// stored with one of its messages, or 0 if none.
+func (r *PostgresRepository) GetRoomSeq(ctx context.Context, roomID string) (int64, error) {
+	query := `
+		SELECT GREATEST(
+			(SELECT COALESCE(MAX(seq), 0) FROM rooms WHERE id = $1),
+			(SELECT COALESCE(MAX(seq), 0) FROM messages WHERE room_id = $1))`
+	var seq int64
+	if err := r.pool.QueryRow(ctx, query, roomID).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to query room sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// ReserveRoomSeqs reserves the next n sequence numbers of a room and returns the
+// highest sequence number now reserved. The room must exist.
+func (r *PostgresRepository) ReserveRoomSeqs(ctx context.Context, roomID string, n int64) (int64, error) {
+	query := `
+		UPDATE rooms
+		SET seq = GREATEST(seq, (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE room_id = $1)) + $2
+		WHERE id = $1
+		RETURNING seq`
+	var seq int64
+	err := r.pool.QueryRow(ctx, query, roomID, n).Scan(&seq)
+	if err == pgx.ErrNoRows {
+		return 0, fmt.Errorf("room %s: %w", roomID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve room sequence numbers: %w", err)
+	}
+	return seq, nil
+}
+
+// GetMessagesSince retrieves up to limit chat messages of a room with a sequence
+// number greater than seq, oldest first.
+func (r *PostgresRepository) GetMessagesSince(ctx context.Context, roomID string, seq int64, limit int) ([]*domain.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.room_id = $1 AND m.seq > $2
+		ORDER BY m.seq ASC
+		LIMIT $3`
+
+	rows, err := r.pool.Query(ctx, query, roomID, seq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages since sequence: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows, "text_message")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.attachMessageDetails(ctx, messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// GetMessageByID retrieves a single chat message, or ErrNotFound if it does not exist.
+func (r *PostgresRepository) GetMessageByID(ctx context.Context, messageID int64) (*domain.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.id = $1`
+
+	msg, err := scanMessage(r.pool.QueryRow(ctx, query, messageID), "text_message")
+	if err == pgx.ErrNoRows {
+		return nil, fmt.Errorf("message %d: %w", messageID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message: %w", err)
+	}
+	if err := r.attachMessageDetails(ctx, []*domain.Message{msg}); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// GetMessageIDByClientMsgID returns the ID and timestamp of the chat message a sender
+// submitted with a client message ID, or ErrNotFound if there is none.
+func (r *PostgresRepository) GetMessageIDByClientMsgID(ctx context.Context, senderID, clientMsgID string) (int64, time.Time, error) {
+	var id int64
+	var timestamp time.Time
+	query := `SELECT id, timestamp FROM messages WHERE sender_id = $1 AND client_msg_id = $2`
+	err := r.pool.QueryRow(ctx, query, senderID, clientMsgID).Scan(&id, &timestamp)
+	if err == pgx.ErrNoRows {
+		return 0, time.Time{}, fmt.Errorf("client message %q: %w", clientMsgID, ErrNotFound)
+	}
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to query message: %w", err)
+	}
+	return id, timestamp, nil
+}
+
+// EditMessage replaces the content of a chat message and its rendered HTML, keeps the
+// previous content in the edit history and returns the edit time. Deleted messages
+// cannot be edited and yield ErrNotFound.
+func (r *PostgresRepository) EditMessage(ctx context.Context, messageID int64, editorID, content, html string) (time.Time, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var previous string
+	queryLock := `SELECT payload FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`
+	err = tx.QueryRow(ctx, queryLock, messageID).Scan(&previous)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, fmt.Errorf("message %d: %w", messageID, ErrNotFound)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to lock message: %w", err)
+	}
+
+	queryHistory := `INSERT INTO message_edits (message_id, previous_payload, edited_by) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, queryHistory, messageID, previous, editorID); err != nil {
+		return time.Time{}, fmt.Errorf("failed to save message edit history: %w", err)
+	}
+
+	var editedAt time.Time
+	queryUpdate := `UPDATE messages SET payload = $2, content_html = $3, edited_at = NOW() WHERE id = $1 RETURNING edited_at`
+	if err := tx.QueryRow(ctx, queryUpdate, messageID, content, html).Scan(&editedAt); err != nil {
+		return time.Time{}, fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return time.Time{}, fmt.Errorf("failed to commit message edit: %w", err)
+	}
+	return editedAt, nil
+}
+
+// DeleteMessage soft-deletes a chat message and returns the deletion time. Messages
+// that do not exist or are already deleted yield ErrNotFound.
+func (r *PostgresRepository) DeleteMessage(ctx context.Context, messageID int64, deletedBy string) (time.Time, error) {
+	query := `
+		UPDATE messages SET deleted_at = NOW(), deleted_by = $2
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING deleted_at`
+	var deletedAt time.Time
+	err := r.pool.QueryRow(ctx, query, messageID, deletedBy).Scan(&deletedAt)
+	if err == pgx.ErrNoRows {
+		return time.Time{}, fmt.Errorf("message %d: %w", messageID, ErrNotFound)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to delete message: %w", err)
+	}
+	return deletedAt, nil
+}
+
+// GetThreadReplies retrieves up to limit replies to a message with an ID lower than
+// beforeID (or the most recent ones if beforeID is 0), oldest first.
+func (r *PostgresRepository) GetThreadReplies(ctx context.Context, parentID int64, beforeID int64, limit int) ([]*domain.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.parent_id = $1 AND ($2 = 0 OR m.id < $2)
+		ORDER BY m.id DESC
+		LIMIT $3`
+
+	rows, err := r.pool.Query(ctx, query, parentID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query thread replies: %w", err)
+	}
+	defer rows.Close()
+
+	replies, err := scanMessages(rows, "text_message")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.attachMessageDetails(ctx, replies); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(replies)-1; i < j; i, j = i+1, j-1 {
+		replies[i], replies[j] = replies[j], replies[i]
+	}
+
+	return replies, nil
+}
+
+// attachMessageDetails fills in the reactions, mentions and attachments of the given
+// chat messages.
+func (r *PostgresRepository) attachMessageDetails(ctx context.Context, messages []*domain.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	reactions, err := r.getReactionsForMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	mentions, err := r.getMentionsForMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+	var attachmentIDs []string
+	for _, msg := range messages {
+		msg.Reactions = reactions[msg.ID]
+		msg.Mentions = mentions[msg.ID]
+		if msg.Attachment != nil {
+			attachmentIDs = append(attachmentIDs, msg.Attachment.ID)
+		}
+	}
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	attachments, err := r.getAttachments(ctx, attachmentIDs)
+	if err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		if msg.Attachment != nil {
+			if a, ok := attachments[msg.Attachment.ID]; ok {
+				msg.Attachment = a
+			}
+		}
+	}
+	return nil
+}
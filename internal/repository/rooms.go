@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// EnsureRoom records a room the first time it is opened. The user opening it becomes
+// its owner; later calls for an existing room have no effect.
+func (r *PostgresRepository) EnsureRoom(ctx context.Context, roomID, userID string) error {
+	query := `
+		WITH created AS (
+			INSERT INTO rooms (id, created_by) VALUES ($1, $2)
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id
+		)
+		INSERT INTO room_roles (room_id, user_id, role, granted_by)
+		SELECT id, $2, $3, $2 FROM created
+		ON CONFLICT (room_id, user_id) DO NOTHING`
+	if _, err := r.pool.Exec(ctx, query, roomID, userID, domain.RoleOwner); err != nil {
+		return fmt.Errorf("failed to ensure room: %w", err)
+	}
+	return nil
+}
+
+// GetRoomRole returns the role of a user in a room, or an empty string if the user
+// has no special role there.
+func (r *PostgresRepository) GetRoomRole(ctx context.Context, roomID, userID string) (string, error) {
+	query := `SELECT role FROM room_roles WHERE room_id = $1 AND user_id = $2`
+	var role string
+	err := r.pool.QueryRow(ctx, query, roomID, userID).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query room role: %w", err)
+	}
+	return role, nil
+}
+
+// SetRoomRole grants a role to a user in a room, or removes the user's role when role
+// is empty. The owner's role cannot be changed this way.
+func (r *PostgresRepository) SetRoomRole(ctx context.Context, roomID, userID, role, grantedBy string) error {
+	if role == "" {
+		query := `DELETE FROM room_roles WHERE room_id = $1 AND user_id = $2 AND role <> $3`
+		if _, err := r.pool.Exec(ctx, query, roomID, userID, domain.RoleOwner); err != nil {
+			return fmt.Errorf("failed to remove room role: %w", err)
+		}
+		return nil
+	}
+
+	query := `
+		INSERT INTO room_roles (room_id, user_id, role, granted_by, granted_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET role = EXCLUDED.role, granted_by = EXCLUDED.granted_by, granted_at = NOW()
+		WHERE room_roles.role <> $5`
+	if _, err := r.pool.Exec(ctx, query, roomID, userID, role, grantedBy, domain.RoleOwner); err != nil {
+		return fmt.Errorf("failed to set room role: %w", err)
+	}
+	return nil
+}
+
+// AddRoomMember records that a user joined a room, or refreshes when they were last seen.
+func (r *PostgresRepository) AddRoomMember(ctx context.Context, roomID, userID string) error {
+	query := `
+		INSERT INTO room_members (room_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (room_id, user_id) DO UPDATE SET last_seen_at = NOW()`
+	if _, err := r.pool.Exec(ctx, query, roomID, userID); err != nil {
+		return fmt.Errorf("failed to add room member: %w", err)
+	}
+	return nil
+}
+
+// FindRoomMembersByUsernames returns the members of a room whose usernames match any
+// of the given names, ignoring case.
+func (r *PostgresRepository) FindRoomMembersByUsernames(ctx context.Context, roomID string, usernames []string) ([]*domain.User, error) {
+	query := `
+		SELECT u.id, u.username
+		FROM room_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.room_id = $1 AND LOWER(u.username) = ANY($2)`
+
+	lowered := make([]string, len(usernames))
+	for i, name := range usernames {
+		lowered[i] = strings.ToLower(name)
+	}
+	rows, err := r.pool.Query(ctx, query, roomID, lowered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query room members: %w", err)
+	}
+	return scanUsers(rows)
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// highlightStart and highlightStop delimit the matches in ts_headline excerpts. They
+// are private-use characters so that the excerpt can be escaped before the markers
+// are turned into tags.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// headlineOptions configures the excerpts returned by ts_headline.
+const headlineOptions = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", MaxFragments=2, MaxWords=30, MinWords=10`
+
+// SearchMessages runs a ranked full-text search over the chat messages of the rooms
+// the searching user is a member of. Deleted messages are never returned.
+func (r *PostgresRepository) SearchMessages(ctx context.Context, q domain.SearchQuery) ([]*domain.SearchHit, error) {
+	query := `
+		WITH search AS (SELECT websearch_to_tsquery('simple', $2) AS query)
+		SELECT m.id, m.room_id, m.sender_id, COALESCE(u.username, ''), COALESCE(m.parent_id, 0), m.payload, m.timestamp,
+			ts_rank(m.search_vector, search.query),
+			ts_headline('simple', m.payload, search.query, $9)
+		FROM messages m
+		CROSS JOIN search
+		LEFT JOIN users u ON u.id = m.sender_id
+		WHERE m.search_vector @@ search.query
+			AND m.deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM room_members rm WHERE rm.room_id = m.room_id AND rm.user_id = $1)
+			AND ($3 = '' OR m.room_id = $3)
+			AND ($4 = '' OR m.sender_id = $4)
+			AND ($5::timestamptz IS NULL OR m.timestamp >= $5)
+			AND ($6::timestamptz IS NULL OR m.timestamp < $6)
+		ORDER BY 8 DESC, m.id DESC
+		LIMIT $7 OFFSET $8`
+
+	rows, err := r.pool.Query(ctx, query, q.UserID, q.Text, q.RoomID, q.SenderID,
+		optionalTime(q.From), optionalTime(q.To), q.Limit, q.Offset, headlineOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []*domain.SearchHit
+	for rows.Next() {
+		var hit domain.SearchHit
+		var rank float32
+		if err := rows.Scan(&hit.MessageID, &hit.RoomID, &hit.SenderID, &hit.SenderName, &hit.ParentID, &hit.Content, &hit.Timestamp,
+			&rank, &hit.Highlight); err != nil {
+			return nil, fmt.Errorf("failed to scan search hit row: %w", err)
+		}
+		hit.Rank = float64(rank)
+		hit.Highlight = highlightHTML(hit.Highlight)
+		hits = append(hits, &hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate search hit rows: %w", err)
+	}
+	return hits, nil
+}
+
+// highlightHTML escapes a ts_headline excerpt and turns its match markers into <mark> tags.
+func highlightHTML(excerpt string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(excerpt))
+}
+
+// optionalTime maps the zero time to NULL.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,365 @@
+// Package richtext validates and renders the content format of chat messages.
+//
+// Messages are written in a small Markdown subset:
+//
+//   - fenced code blocks delimited by ``` lines, with an optional language name
+//   - `inline code`
+//   - **bold**, *italic* or _italic_, and ~~strikethrough~~
+//   - [links](https://example.com) and bare http(s) URLs
+//   - @username mentions
+//
+// Raw HTML is not part of the format. Tags are stripped from the source outside of
+// code, and everything is escaped when rendering, so the normalized HTML form only
+// ever contains the tags produced by this package.
+package richtext
+
+import (
+	"errors"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the maximum number of characters in a message source.
+const MaxLength = 4000
+
+var (
+	// ErrEmpty is returned for messages without any content left after sanitizing.
+	ErrEmpty = errors.New("message is empty")
+
+	// ErrTooLong is returned for messages longer than MaxLength characters.
+	ErrTooLong = errors.New("message is too long")
+)
+
+// Content is a validated chat message.
+type Content struct {
+	// Source is the sanitized Markdown source.
+	Source string
+
+	// HTML is the normalized form of the message, safe to insert into a page.
+	HTML string
+}
+
+var (
+	// dangerousElementPattern matches elements whose content must go along with the tags.
+	dangerousElementPattern = regexp.MustCompile(`(?is)<(script|style|iframe|object|embed|template)\b[^>]*>.*?</(script|style|iframe|object|embed|template)\s*>`)
+
+	// htmlTagPattern matches any other HTML tag or comment.
+	htmlTagPattern = regexp.MustCompile(`(?s)<!--.*?-->|</?[a-zA-Z][^>]*>`)
+
+	// mentionPattern matches @username tokens that start the text or follow whitespace.
+	mentionPattern = regexp.MustCompile(`(?:^|\s)@([\p{L}\p{N}_.\-]+)`)
+)
+
+// Parse sanitizes a message source and renders its normalized HTML form.
+func Parse(source string) (*Content, error) {
+	source = normalize(source)
+
+	blocks := splitBlocks(source)
+	var src, out strings.Builder
+	for i, blk := range blocks {
+		if i > 0 {
+			src.WriteByte('\n')
+		}
+		if blk.code {
+			src.WriteString("```" + blk.lang + "\n" + blk.text + "\n```")
+			out.WriteString(renderCodeBlock(blk))
+			continue
+		}
+		text := stripHTML(blk.text)
+		src.WriteString(text)
+		out.WriteString(renderParagraphs(text))
+	}
+
+	content := &Content{Source: strings.TrimSpace(src.String()), HTML: out.String()}
+	if content.Source == "" {
+		return nil, ErrEmpty
+	}
+	if utf8.RuneCountInString(content.Source) > MaxLength {
+		return nil, ErrTooLong
+	}
+	return content, nil
+}
+
+// Mentions returns the distinct usernames mentioned outside of code in a message
+// source, in order of appearance. Trailing dots are treated as punctuation.
+func Mentions(source string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, blk := range splitBlocks(normalize(source)) {
+		if blk.code {
+			continue
+		}
+		for _, match := range mentionPattern.FindAllStringSubmatch(withoutInlineCode(blk.text), -1) {
+			name := strings.TrimRight(match[1], ".")
+			key := strings.ToLower(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// normalize makes line endings consistent, replaces invalid UTF-8 and drops control
+// characters other than newlines and tabs.
+func normalize(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// stripHTML removes HTML tags from text, keeping inline code spans intact.
+func stripHTML(text string) string {
+	var b strings.Builder
+	backticks := strings.Count(text, "`")
+	for i, part := range strings.Split(text, "`") {
+		if i > 0 {
+			b.WriteByte('`')
+		}
+		// Odd parts are inside inline code, unless their closing backtick is missing.
+		if i%2 == 1 && i < backticks {
+			b.WriteString(part)
+			continue
+		}
+		b.WriteString(stripTags(part))
+	}
+	return b.String()
+}
+
+// stripTags removes HTML tags from text until none are left, since removing a tag
+// nested in another, as in "<<b>script>", may join the remains into a new tag.
+// Dangerous elements are removed first, so that their content goes along with any
+// element rebuilt this way.
+func stripTags(text string) string {
+	for {
+		stripped := dangerousElementPattern.ReplaceAllString(text, "")
+		if stripped == text {
+			stripped = htmlTagPattern.ReplaceAllString(text, "")
+		}
+		if stripped == text {
+			return text
+		}
+		text = stripped
+	}
+}
+
+// withoutInlineCode blanks out inline code spans so they are not scanned for mentions.
+func withoutInlineCode(text string) string {
+	parts := strings.Split(text, "`")
+	for i := 1; i < len(parts)-1; i += 2 {
+		parts[i] = " "
+	}
+	return strings.Join(parts, "`")
+}
+
+// block is a run of text or a fenced code block.
+type block struct {
+	code bool
+	lang string
+	text string
+}
+
+// splitBlocks splits a source into text and fenced code blocks. An unterminated fence
+// extends to the end of the message.
+func splitBlocks(source string) []block {
+	var blocks []block
+	var lines []string
+	inCode := false
+	lang := ""
+
+	flush := func() {
+		if inCode || len(lines) > 0 {
+			blocks = append(blocks, block{code: inCode, lang: lang, text: strings.Join(lines, "\n")})
+		}
+		lines = nil
+	}
+
+	for _, line := range strings.Split(source, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flush()
+			if inCode {
+				inCode, lang = false, ""
+			} else {
+				inCode = true
+				lang = codeLanguage(strings.TrimPrefix(strings.TrimSpace(line), "```"))
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return blocks
+}
+
+// codeLanguage keeps a code block language name only if it is a plain identifier.
+func codeLanguage(s string) string {
+	s = strings.TrimSpace(s)
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune("+-#_.", r) {
+			return ""
+		}
+	}
+	if len(s) > 20 {
+		return ""
+	}
+	return s
+}
+
+// renderCodeBlock renders a fenced code block.
+func renderCodeBlock(blk block) string {
+	class := ""
+	if blk.lang != "" {
+		class = ` class="language-` + html.EscapeString(blk.lang) + `"`
+	}
+	return "<pre><code" + class + ">" + html.EscapeString(blk.text) + "</code></pre>"
+}
+
+// renderParagraphs renders text separated by blank lines as paragraphs, with single
+// newlines as line breaks.
+func renderParagraphs(text string) string {
+	var b strings.Builder
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		lines := strings.Split(para, "\n")
+		for i, line := range lines {
+			lines[i] = renderInline(line)
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+// renderInline renders the inline elements of a single line, escaping everything else.
+func renderInline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				b.WriteString("<code>" + html.EscapeString(rest[1:1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+		case rest[0] == '[':
+			if text, href, n, ok := parseLink(rest); ok {
+				b.WriteString(anchor(href, renderInline(text)))
+				i += n
+				continue
+			}
+		case (strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://")) && atWordStart(s, i):
+			n := urlLength(rest)
+			if href := rest[:n]; safeURL(href) {
+				b.WriteString(anchor(href, html.EscapeString(href)))
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "~~"):
+			delim := rest[:2]
+			if end := strings.Index(rest[2:], delim); end > 0 {
+				tag := "strong"
+				if delim == "~~" {
+					tag = "del"
+				}
+				b.WriteString("<" + tag + ">" + renderInline(rest[2:2+end]) + "</" + tag + ">")
+				i += end + 4
+				continue
+			}
+		case (rest[0] == '*' || rest[0] == '_') && atWordStart(s, i):
+			if end := strings.IndexByte(rest[1:], rest[0]); end > 0 && !unicode.IsSpace(rune(rest[1])) {
+				b.WriteString("<em>" + renderInline(rest[1:1+end]) + "</em>")
+				i += end + 2
+				continue
+			}
+		case rest[0] == '@' && atWordStart(s, i):
+			if loc := mentionPattern.FindStringSubmatchIndex(rest); loc != nil && loc[0] == 0 {
+				name := strings.TrimRight(rest[loc[2]:loc[3]], ".")
+				if name != "" {
+					b.WriteString(`<span class="mention">@` + html.EscapeString(name) + `</span>`)
+					i += 1 + len(name)
+					continue
+				}
+			}
+		}
+		_, size := utf8.DecodeRuneInString(rest)
+		b.WriteString(html.EscapeString(rest[:size]))
+		i += size
+	}
+	return b.String()
+}
+
+// parseLink parses a [text](url) link at the start of s and returns its parts and
+// length. Links with unsafe URLs are not recognized.
+func parseLink(s string) (text, href string, n int, ok bool) {
+	closeText := strings.Index(s, "](")
+	if closeText <= 1 {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL <= 0 {
+		return "", "", 0, false
+	}
+	text = s[1:closeText]
+	href = s[closeText+2 : closeText+2+closeURL]
+	if strings.ContainsAny(href, " \t") || !safeURL(href) {
+		return "", "", 0, false
+	}
+	return text, href, closeText + 3 + closeURL, true
+}
+
+// urlLength returns the length of the bare URL at the start of s, leaving out
+// trailing punctuation.
+func urlLength(s string) int {
+	n := strings.IndexFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == '<' || r == '>' || r == '"' })
+	if n < 0 {
+		n = len(s)
+	}
+	for n > 0 && strings.ContainsRune(".,;:!?)'", rune(s[n-1])) {
+		n--
+	}
+	return n
+}
+
+// safeURL reports whether a link target uses an allowed scheme.
+func safeURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// anchor renders a link that opens outside the application.
+func anchor(href, inner string) string {
+	return `<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">` + inner + `</a>`
+}
+
+// atWordStart reports whether position i of s starts a new word.
+func atWordStart(s string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+	return unicode.IsSpace(r) || unicode.IsPunct(r) && r != '_' && r != '*'
+}
@@ -0,0 +1,135 @@
+package richtext
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+		html   string
+	}{
+		{
+			name:   "plain text",
+			source: "hello",
+			want:   "hello",
+			html:   "<p>hello</p>",
+		},
+		{
+			name:   "tags",
+			source: "<b>bold</b> <img src=x onerror=alert(1)>text",
+			want:   "bold text",
+			html:   "<p>bold text</p>",
+		},
+		{
+			name:   "script element",
+			source: "a<script>alert(1)</script>b",
+			want:   "ab",
+			html:   "<p>ab</p>",
+		},
+		{
+			name:   "nested tags",
+			source: "<<b>script>alert(1)<</b>/script>ok",
+			want:   "ok",
+			html:   "<p>ok</p>",
+		},
+		{
+			name:   "deeply nested tags",
+			source: "<<<i>b>script>alert(1)<<<i>/b>/script>x",
+			want:   "x",
+			html:   "<p>x</p>",
+		},
+		{
+			name:   "nested script element",
+			source: "<scr<script>x</script>ipt>alert(1)</script>ok",
+			want:   "ok",
+			html:   "<p>ok</p>",
+		},
+		{
+			name:   "unclosed tag",
+			source: "hi <img src=x onerror=alert(1)",
+			want:   "hi <img src=x onerror=alert(1)",
+			html:   "<p>hi &lt;img src=x onerror=alert(1)</p>",
+		},
+		{
+			name:   "comment",
+			source: "a<!-- <script>alert(1)</script> -->b",
+			want:   "ab",
+			html:   "<p>ab</p>",
+		},
+		{
+			name:   "entities",
+			source: "&lt;script&gt;alert(1)&lt;/script&gt;",
+			want:   "&lt;script&gt;alert(1)&lt;/script&gt;",
+			html:   "<p>&amp;lt;script&amp;gt;alert(1)&amp;lt;/script&amp;gt;</p>",
+		},
+		{
+			name:   "inline code keeps tags",
+			source: "use `<b>` for bold",
+			want:   "use `<b>` for bold",
+			html:   "<p>use <code>&lt;b&gt;</code> for bold</p>",
+		},
+		{
+			name:   "code block keeps tags",
+			source: "```html\n<script>x</script>\n```",
+			want:   "```html\n<script>x</script>\n```",
+			html:   `<pre><code class="language-html">&lt;script&gt;x&lt;/script&gt;</code></pre>`,
+		},
+		{
+			name:   "javascript link",
+			source: "[click](javascript:alert(1))",
+			want:   "[click](javascript:alert(1))",
+			html:   "<p>[click](javascript:alert(1))</p>",
+		},
+		{
+			name:   "link",
+			source: "see [docs](https://example.com/a?b=1&c=2)",
+			want:   "see [docs](https://example.com/a?b=1&c=2)",
+			html:   `<p>see <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer" target="_blank">docs</a></p>`,
+		},
+		{
+			name:   "formatting and mention",
+			source: "**hi** @bob\nbye",
+			want:   "**hi** @bob\nbye",
+			html:   `<p><strong>hi</strong> <span class="mention">@bob</span><br>bye</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.source)
+			if err != nil {
+				t.Fatalf("Parse(%q) error: %v", tt.source, err)
+			}
+			if got.Source != tt.want {
+				t.Errorf("Parse(%q).Source = %q, want %q", tt.source, got.Source, tt.want)
+			}
+			if got.HTML != tt.html {
+				t.Errorf("Parse(%q).HTML = %q, want %q", tt.source, got.HTML, tt.html)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   error
+	}{
+		{name: "empty", source: "", want: ErrEmpty},
+		{name: "only tags", source: "<b></b><<i>script></script>", want: ErrEmpty},
+		{name: "nested script", source: "<<b>script>alert(1)<</b>/script>", want: ErrEmpty},
+		{name: "too long", source: strings.Repeat("a", MaxLength+1), want: ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.source); !errors.Is(err, tt.want) {
+				t.Errorf("Parse(%q) error = %v, want %v", tt.source, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSystemStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileSystemStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatalf("NewFileSystemStore: %v", err)
+	}
+	const key = "rooms/general/file.txt"
+
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	body, _ := io.ReadAll(r)
+	r.Close()
+	if string(body) != "hello" {
+		t.Errorf("Get = %q, want %q", body, "hello")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+func TestFileSystemStoreShortWrite(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewFileSystemStore(root)
+	if err != nil {
+		t.Fatalf("NewFileSystemStore: %v", err)
+	}
+
+	if err := store.Put(ctx, "short", strings.NewReader("abc"), 5, ""); err == nil {
+		t.Fatal("Put accepted fewer bytes than announced")
+	}
+	if _, err := store.Get(ctx, "short"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get of a failed upload error = %v, want ErrBlobNotFound", err)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 0 {
+		t.Errorf("failed upload left %d files behind", len(entries))
+	}
+}
+
+func TestFileSystemStoreInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	store, err := NewFileSystemStore(filepath.Join(parent, "blobs"))
+	if err != nil {
+		t.Fatalf("NewFileSystemStore: %v", err)
+	}
+	secret := filepath.Join(parent, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"",
+		"../secret.txt",
+		"rooms/../../secret.txt",
+		"/etc/passwd",
+		`..\secret.txt`,
+		"rooms//file",
+		"./file",
+		"rooms/",
+	} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) accepted an invalid key", key)
+		}
+		if r, err := store.Get(ctx, key); err == nil {
+			r.Close()
+			t.Errorf("Get(%q) accepted an invalid key", key)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) accepted an invalid key", key)
+		}
+	}
+	if data, err := os.ReadFile(secret); err != nil || string(data) != "secret" {
+		t.Errorf("file outside the store changed: %q, %v", data, err)
+	}
+}
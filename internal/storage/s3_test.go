@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an in-memory stand-in for an S3-compatible service. It checks that every
+// request is signed and records the last one.
+type fakeS3 struct {
+	t *testing.T
+
+	// missingDeleteStatus is the status of deletions of missing objects.
+	missingDeleteStatus int
+
+	mu      sync.Mutex
+	objects map[string]string
+	types   map[string]string
+	last    *http.Request
+}
+
+var authorizationPattern = regexp.MustCompile(`^AWS4-HMAC-SHA256 ` +
+	`Credential=test-access/\d{8}/eu-test-1/s3/aws4_request, ` +
+	`SignedHeaders=host;x-amz-content-sha256;x-amz-date, ` +
+	`Signature=[0-9a-f]{64}$`)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = r
+
+	if auth := r.Header.Get("Authorization"); !authorizationPattern.MatchString(auth) {
+		f.t.Errorf("%s %s: malformed Authorization header %q", r.Method, r.URL.Path, auth)
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	if _, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date")); err != nil {
+		f.t.Errorf("%s %s: malformed X-Amz-Date: %v", r.Method, r.URL.Path, err)
+	}
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != unsignedPayload {
+		f.t.Errorf("%s %s: X-Amz-Content-Sha256 = %q, want %q", r.Method, r.URL.Path, got, unsignedPayload)
+	}
+
+	path := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[path] = string(body)
+		f.types[path] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		body, ok := f.objects[path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", f.types[path])
+		io.WriteString(w, body)
+	case http.MethodDelete:
+		if _, ok := f.objects[path]; !ok {
+			w.WriteHeader(f.missingDeleteStatus)
+			return
+		}
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestS3Store(t *testing.T, missingDeleteStatus int) (*S3Store, *fakeS3) {
+	t.Helper()
+	fake := &fakeS3{
+		t:                   t,
+		missingDeleteStatus: missingDeleteStatus,
+		objects:             make(map[string]string),
+		types:               make(map[string]string),
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  srv.URL + "/",
+		Region:    "eu-test-1",
+		Bucket:    "uploads",
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	return store, fake
+}
+
+func TestS3Store(t *testing.T) {
+	ctx := context.Background()
+	store, fake := newTestS3Store(t, http.StatusNoContent)
+	const key = "rooms/general/a b+c.txt"
+
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got, want := fake.last.URL.EscapedPath(), "/uploads/rooms/general/a%20b%2Bc.txt"; got != want {
+		t.Errorf("Put path = %q, want %q", got, want)
+	}
+	if got := fake.types["/uploads/rooms/general/a%20b%2Bc.txt"]; got != "text/plain" {
+		t.Errorf("stored content type = %q, want text/plain", got)
+	}
+
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	body, _ := io.ReadAll(r)
+	r.Close()
+	if string(body) != "hello" {
+		t.Errorf("Get = %q, want %q", body, "hello")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+}
+
+func TestS3StoreDeleteMissingNotFound(t *testing.T) {
+	store, _ := newTestS3Store(t, http.StatusNotFound)
+	if err := store.Delete(context.Background(), "missing"); err != nil {
+		t.Errorf("Delete of a missing blob answered with 404: %v", err)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "SlowDown", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	store, err := NewS3Store(S3Config{Endpoint: srv.URL, Bucket: "uploads"})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+
+	if err := store.Put(ctx, "a", strings.NewReader("x"), 1, ""); err == nil || !strings.Contains(err.Error(), "SlowDown") {
+		t.Errorf("Put error = %v, want the service's error", err)
+	}
+	if _, err := store.Get(ctx, "a"); err == nil || errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get error = %v, want a service error", err)
+	}
+	for _, key := range []string{"", "/absolute"} {
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) accepted an invalid key", key)
+		}
+	}
+}
+
+func TestNewS3StoreConfig(t *testing.T) {
+	for _, cfg := range []S3Config{
+		{Endpoint: "", Bucket: "uploads"},
+		{Endpoint: "not a url", Bucket: "uploads"},
+		{Endpoint: "http://localhost:9000"},
+	} {
+		if _, err := NewS3Store(cfg); err == nil {
+			t.Errorf("NewS3Store(%+v) accepted an invalid configuration", cfg)
+		}
+	}
+}
+
+func TestS3StoreSign(t *testing.T) {
+	store, err := NewS3Store(S3Config{Endpoint: "http://localhost:9000", Bucket: "b", AccessKey: "k", SecretKey: "s"})
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	signature := func(key string) string {
+		req, err := store.newRequest(context.Background(), http.MethodGet, key, nil)
+		if err != nil {
+			t.Fatalf("newRequest: %v", err)
+		}
+		store.sign(req, now)
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=k/20240501/us-east-1/s3/aws4_request, ") {
+			t.Errorf("Authorization = %q, want the default region in the scope", auth)
+		}
+		return auth[strings.LastIndex(auth, "=")+1:]
+	}
+
+	if signature("a") != signature("a") {
+		t.Error("signing the same request twice gave different signatures")
+	}
+	if signature("a") == signature("b") {
+		t.Error("requests for different objects got the same signature")
+	}
+}
@@ -0,0 +1,24 @@
+// Package storage keeps uploaded files in a blob store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrBlobNotFound is returned when a requested blob does not exist.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque blobs under string keys. Keys are slash-separated paths
+// chosen by the server, never by clients.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the blob stored under key. The caller must close the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,272 @@
+package websocket
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Lec7ral/WithWebSocket/internal/audit"
+	"github.com/Lec7ral/WithWebSocket/internal/auth"
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultAuditLimit and maxAuditLimit bound the number of audit events returned by
+// the audit endpoint. Exports may return up to maxAuditExportLimit events.
+const (
+	defaultAuditLimit   = 100
+	maxAuditLimit       = 1000
+	maxAuditExportLimit = 50000
+)
+
+// HandleGetAuditEvents is the HTTP handler for the GET /api/admin/audit endpoint.
+// It returns audit events newest first, filtered by the optional type, actor, room,
+// target, from, to and before parameters. The format parameter selects JSON (the
+// default), or a CSV or JSON Lines export.
+func (h *Handler) HandleGetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "jsonl" {
+		http.Error(w, "Invalid format parameter", http.StatusBadRequest)
+		return
+	}
+
+	q := domain.AuditQuery{
+		Type:     params.Get("type"),
+		ActorID:  params.Get("actor"),
+		RoomID:   params.Get("room"),
+		TargetID: params.Get("target"),
+		Limit:    defaultAuditLimit,
+	}
+	var ok bool
+	if q.From, ok = searchTime(params.Get("from")); !ok {
+		http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+		return
+	}
+	if q.To, ok = searchTime(params.Get("to")); !ok {
+		http.Error(w, "Invalid to parameter", http.StatusBadRequest)
+		return
+	}
+	if q.BeforeID, ok = historyBefore(r); !ok {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+	maxLimit := maxAuditLimit
+	if format != "json" {
+		maxLimit = maxAuditExportLimit
+	}
+	if limitParam := params.Get("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		q.Limit = min(n, maxLimit)
+	}
+
+	events, err := h.repo.GetAuditEvents(r.Context(), q)
+	if err != nil {
+		slog.Error("Failed to load audit events", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if events == nil {
+		events = []*domain.AuditEvent{}
+	}
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+		w.WriteHeader(http.StatusOK)
+		if err := writeAuditCSV(w, events); err != nil {
+			slog.Error("Failed to write audit CSV export", "error", err)
+		}
+	case "jsonl":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		for _, e := range events {
+			if err := enc.Encode(e); err != nil {
+				slog.Error("Failed to write audit JSONL export", "error", err)
+				return
+			}
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(events); err != nil {
+			slog.Error("Failed to write audit events response", "error", err)
+		}
+	}
+}
+
+// writeAuditCSV writes audit events as CSV with a header row. Details are written as
+// a JSON object.
+func writeAuditCSV(w http.ResponseWriter, events []*domain.AuditEvent) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"id", "time", "type", "actor_id", "actor_name", "room_id", "target_id", "remote_addr", "details"}); err != nil {
+		return err
+	}
+	for _, e := range events {
+		details := ""
+		if len(e.Details) > 0 {
+			encoded, err := json.Marshal(e.Details)
+			if err != nil {
+				return err
+			}
+			details = string(encoded)
+		}
+		record := []string{
+			strconv.FormatInt(e.ID, 10), e.Time.UTC().Format(time.RFC3339Nano), e.Type,
+			e.ActorID, e.ActorName, e.RoomID, e.TargetID, e.RemoteAddr, details,
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// maxAnnouncementLength bounds the text of a system announcement, in characters.
+const maxAnnouncementLength = 1000
+
+// HandleListClients is the HTTP handler for the GET /api/admin/clients endpoint. It
+// returns the live connections of every room, or of the room given by the optional
+// room parameter.
+func (h *Handler) HandleListClients(w http.ResponseWriter, r *http.Request) {
+	clients := h.hub.ListClients(r.URL.Query().Get("room"))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(clients); err != nil {
+		slog.Error("Failed to write clients response", "error", err)
+	}
+}
+
+// HandleDisconnectClient is the HTTP handler for the DELETE
+// /api/admin/clients/{connID} endpoint. It closes a single connection.
+func (h *Handler) HandleDisconnectClient(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	connID := chi.URLParam(r, "connID")
+
+	client := h.hub.DisconnectClient(connID)
+	if client == nil {
+		http.Error(w, "Client not found", http.StatusNotFound)
+		return
+	}
+	h.hub.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditAdminAction,
+		ActorID:    claims.UserID,
+		ActorName:  claims.Username,
+		RoomID:     client.RoomID,
+		TargetID:   client.UserID,
+		RemoteAddr: audit.RemoteAddr(r),
+		Details:    map[string]string{"action": "disconnect_client", "conn_id": connID},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CloseRoomResponse is the response of the room closing endpoint.
+type CloseRoomResponse struct {
+	Disconnected int `json:"disconnected"`
+}
+
+// HandleCloseRoom is the HTTP handler for the DELETE /api/admin/rooms/{roomID}
+// endpoint. It disconnects every client of a room.
+func (h *Handler) HandleCloseRoom(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	roomID := chi.URLParam(r, "roomID")
+
+	n := h.hub.CloseRoom(roomID)
+	if n == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	h.hub.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditAdminAction,
+		ActorID:    claims.UserID,
+		ActorName:  claims.Username,
+		RoomID:     roomID,
+		RemoteAddr: audit.RemoteAddr(r),
+		Details:    map[string]string{"action": "close_room", "disconnected": strconv.Itoa(n)},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(CloseRoomResponse{Disconnected: n}); err != nil {
+		slog.Error("Failed to write close room response", "error", err)
+	}
+}
+
+// AnnouncementRequest defines the structure of a request to broadcast a system
+// announcement. An empty RoomID addresses every room.
+type AnnouncementRequest struct {
+	RoomID string `json:"room_id"`
+	Text   string `json:"text"`
+}
+
+// AnnouncementResponse is the response of the announcement endpoint.
+type AnnouncementResponse struct {
+	Rooms int `json:"rooms"`
+}
+
+// HandleAnnounce is the HTTP handler for the POST /api/admin/announcements endpoint.
+// It broadcasts a `system_announcement` event to one or all active rooms.
+func (h *Handler) HandleAnnounce(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.ClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" || utf8.RuneCountInString(req.Text) > maxAnnouncementLength {
+		http.Error(w, "Announcement text must be between 1 and 1000 characters", http.StatusBadRequest)
+		return
+	}
+
+	n := h.hub.Announce(req.RoomID, domain.AnnouncementPayload{Text: req.Text, From: claims.Username})
+	if req.RoomID != "" && n == 0 {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	h.hub.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditAdminAction,
+		ActorID:    claims.UserID,
+		ActorName:  claims.Username,
+		RoomID:     req.RoomID,
+		RemoteAddr: audit.RemoteAddr(r),
+		Details:    map[string]string{"action": "announcement", "text": req.Text},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(AnnouncementResponse{Rooms: n}); err != nil {
+		slog.Error("Failed to write announcement response", "error", err)
+	}
+}
@@ -0,0 +1,328 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Lec7ral/WithWebSocket/internal/auth"
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/media"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+	"github.com/Lec7ral/WithWebSocket/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// thumbnailSize is the largest width and height of generated image thumbnails.
+const thumbnailSize = 320
+
+// multipartOverhead is the room left for multipart headers and boundaries on top of
+// the maximum upload size when limiting the size of upload requests.
+const multipartOverhead = 64 << 10
+
+// allowedUploadTypes lists the media types accepted for attachments, as detected from
+// the content of the file. Types mapped to true are shown inline by browsers; all
+// others are always downloaded.
+var allowedUploadTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": false,
+	"text/plain":      false,
+	"application/zip": false,
+}
+
+// thumbnailTypes lists the image types thumbnails can be generated for.
+var thumbnailTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// HandleUploadAttachment is the HTTP handler for the POST /api/rooms/{roomID}/attachments
+// endpoint. It stores the file sent in the "file" field of a multipart form for
+// members of the room and returns the new attachment, which can then be shared in the
+// room with an `attachment` message.
+func (h *Handler) HandleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	if !h.checkRoomMember(w, r, roomID, claims.UserID) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize+multipartOverhead)
+	fileName, data, err := h.readUpload(r)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, errUploadTooLarge) {
+		http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if _, ok := allowedUploadTypes[mediaType]; !ok {
+		http.Error(w, "File type is not allowed", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id := uuid.NewString()
+	attachment := &domain.Attachment{
+		ID:          id,
+		RoomID:      roomID,
+		UploaderID:  claims.UserID,
+		FileName:    sanitizeFileName(fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		BlobKey:     "attachments/" + id,
+	}
+
+	var thumb *media.Thumbnail
+	if thumbnailTypes[mediaType] {
+		attachment.Width, attachment.Height, err = media.ImageSize(data)
+		if err != nil {
+			http.Error(w, "Invalid image", http.StatusBadRequest)
+			return
+		}
+		thumb, err = media.MakeThumbnail(data, thumbnailSize)
+		if err != nil {
+			// The file is still shared, just without a preview.
+			slog.Warn("Failed to generate thumbnail", "error", err, "attachmentID", id)
+		}
+	}
+
+	ctx := r.Context()
+	if err := h.blobs.Put(ctx, attachment.BlobKey, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+		slog.Error("Failed to store attachment", "error", err, "attachmentID", id)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if thumb != nil {
+		key := "thumbnails/" + id + thumbnailExtension(thumb.ContentType)
+		if err := h.blobs.Put(ctx, key, bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType); err != nil {
+			slog.Error("Failed to store thumbnail", "error", err, "attachmentID", id)
+		} else {
+			attachment.ThumbnailKey = key
+		}
+	}
+
+	if err := h.repo.SaveAttachment(ctx, attachment); err != nil {
+		slog.Error("Failed to save attachment", "error", err, "attachmentID", id)
+		h.deleteBlobs(attachment)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(attachment); err != nil {
+		slog.Error("Failed to write attachment response", "error", err)
+	}
+}
+
+// HandleGetAttachment is the HTTP handler for the GET /api/attachments/{attachmentID}
+// endpoint. It downloads an attachment for members of its room.
+func (h *Handler) HandleGetAttachment(w http.ResponseWriter, r *http.Request) {
+	h.serveAttachment(w, r, false)
+}
+
+// HandleGetAttachmentThumbnail is the HTTP handler for the
+// GET /api/attachments/{attachmentID}/thumbnail endpoint.
+func (h *Handler) HandleGetAttachmentThumbnail(w http.ResponseWriter, r *http.Request) {
+	h.serveAttachment(w, r, true)
+}
+
+// serveAttachment streams an attachment or its thumbnail from the blob store.
+func (h *Handler) serveAttachment(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	attachmentID := chi.URLParam(r, "attachmentID")
+
+	attachment, err := h.repo.GetAttachment(r.Context(), attachmentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load attachment", "error", err, "attachmentID", attachmentID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkRoomMember(w, r, attachment.RoomID, claims.UserID) {
+		return
+	}
+
+	key, contentType := attachment.BlobKey, attachment.ContentType
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			http.Error(w, "Attachment has no thumbnail", http.StatusNotFound)
+			return
+		}
+		key, contentType = attachment.ThumbnailKey, mime.TypeByExtension(path.Ext(attachment.ThumbnailKey))
+	}
+
+	blob, err := h.blobs.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrBlobNotFound) {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to open attachment", "error", err, "attachmentID", attachmentID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+	disposition := "attachment"
+	if thumbnail || allowedUploadTypes[mediaType] {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, blob); err != nil {
+		slog.Warn("Failed to write attachment", "error", err, "attachmentID", attachmentID)
+	}
+}
+
+// checkRoomMember verifies that a user has joined a room and is not banned from it,
+// and responds with an error if not. Banned users stay members of the room.
+func (h *Handler) checkRoomMember(w http.ResponseWriter, r *http.Request, roomID, userID string) bool {
+	member, err := h.repo.IsRoomMember(r.Context(), roomID, userID)
+	if err != nil {
+		slog.Error("Failed to check room membership", "error", err, "roomID", roomID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !member {
+		http.Error(w, "Not a member of this room", http.StatusForbidden)
+		return false
+	}
+	banned, err := h.repo.IsBanned(r.Context(), roomID, userID)
+	if err != nil {
+		slog.Error("Failed to check room ban", "error", err, "roomID", roomID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if banned {
+		http.Error(w, "You are banned from this room", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// errUploadTooLarge is returned by readUpload for files over the maximum upload size.
+var errUploadTooLarge = errors.New("file is too large")
+
+// readUpload reads the name and content of the "file" field of a multipart upload.
+func (h *Handler) readUpload(r *http.Request) (string, []byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", nil, errors.New("missing file field")
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(part, h.maxUploadSize+1))
+		part.Close()
+		if err != nil {
+			return "", nil, err
+		}
+		if int64(len(data)) > h.maxUploadSize {
+			return "", nil, errUploadTooLarge
+		}
+		if len(data) == 0 {
+			return "", nil, errors.New("file is empty")
+		}
+		return part.FileName(), data, nil
+	}
+}
+
+// deleteBlobs removes the stored files of an attachment that could not be recorded.
+func (h *Handler) deleteBlobs(a *domain.Attachment) {
+	for _, key := range []string{a.BlobKey, a.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := h.blobs.Delete(context.Background(), key); err != nil {
+			slog.Warn("Failed to delete orphaned blob", "error", err, "key", key)
+		}
+	}
+}
+
+// sanitizeFileName keeps the base name of an uploaded file without control characters,
+// truncated to fit the database column.
+func sanitizeFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// thumbnailExtension returns the file extension used for thumbnails of a content type.
+func thumbnailExtension(contentType string) string {
+	if contentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// resolveAttachment checks that an `attachment` message shares a file its sender
+// uploaded to the room, and turns it into a chat message carrying the attachment with
+// the caption as its content. The sender is sent an error if the file cannot be shared.
+func (h *Hub) resolveAttachment(c *Client, message *domain.Message) bool {
+	payload, ok := message.Payload.(domain.AttachmentPayload)
+	if !ok {
+		return false
+	}
+	attachment, err := h.repo.GetAttachment(context.Background(), payload.AttachmentID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("Failed to load attachment", "error", err, "attachmentID", payload.AttachmentID)
+	}
+	if err != nil || attachment.RoomID != message.RoomID || attachment.UploaderID != c.ID {
+		h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "attachment not found")
+		return false
+	}
+	message.Payload = payload.Caption
+	message.Attachment = attachment
+	return true
+}
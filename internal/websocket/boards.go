@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+)
+
+// boardSaveInterval is how often boards changed by frequent updates, such as images
+// being dragged, are saved.
+const boardSaveInterval = 2 * time.Second
+
+// boardSaver writes whiteboard snapshots to the database in the background, so that
+// the hub's event loop never waits for them. Only the latest snapshot of a room is
+// kept until it is written, and loads see it, so a room reloaded before its board
+// was written still gets the latest board.
+type boardSaver struct {
+	repo repository.Repository
+
+	mu      sync.Mutex
+	pending map[string]*domain.WhiteboardState
+	wake    chan struct{}
+
+	// versions counts the snapshots scheduled for each room, so that a board loaded
+	// ahead of time can be checked for changes scheduled since.
+	versions map[string]uint64
+}
+
+func newBoardSaver(repo repository.Repository) *boardSaver {
+	return &boardSaver{
+		repo:     repo,
+		pending:  make(map[string]*domain.WhiteboardState),
+		wake:     make(chan struct{}, 1),
+		versions: make(map[string]uint64),
+	}
+}
+
+// save schedules a snapshot of the board of a room to be written, replacing any
+// snapshot of the room not written yet. The snapshot must not be modified afterwards.
+func (s *boardSaver) save(roomID string, snapshot *domain.WhiteboardState) {
+	s.mu.Lock()
+	s.pending[roomID] = snapshot
+	s.versions[roomID]++
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// load returns the board of a room: its snapshot not written yet, if any, or the
+// board stored in the database. It also returns the version of the board, which
+// changes whenever a newer snapshot of the room is scheduled.
+func (s *boardSaver) load(ctx context.Context, roomID string) (*domain.WhiteboardState, uint64, error) {
+	s.mu.Lock()
+	snapshot, ok := s.pending[roomID]
+	version := s.versions[roomID]
+	s.mu.Unlock()
+	if ok {
+		return cloneWhiteboardState(snapshot), version, nil
+	}
+	state, err := s.repo.GetWhiteboardState(ctx, roomID)
+	return state, version, err
+}
+
+// version returns the current version of the board of a room.
+func (s *boardSaver) version(roomID string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.versions[roomID]
+}
+
+// run writes the scheduled snapshots, one at a time, until the process exits.
+func (s *boardSaver) run() {
+	for range s.wake {
+		for {
+			roomID, snapshot, ok := s.next()
+			if !ok {
+				break
+			}
+			if err := s.repo.SaveWhiteboardState(context.Background(), roomID, snapshot); err != nil {
+				slog.Error("Failed to save whiteboard state", "error", err, "roomID", roomID)
+			}
+			s.mu.Lock()
+			// A newer snapshot scheduled in the meantime is written on the next round.
+			if s.pending[roomID] == snapshot {
+				delete(s.pending, roomID)
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// next returns a scheduled snapshot to write, leaving it scheduled until it is.
+func (s *boardSaver) next() (string, *domain.WhiteboardState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for roomID, snapshot := range s.pending {
+		return roomID, snapshot, true
+	}
+	return "", nil, false
+}
+
+// cloneWhiteboardState returns a copy of a board that shares nothing with it.
+func cloneWhiteboardState(state *domain.WhiteboardState) *domain.WhiteboardState {
+	clone := &domain.WhiteboardState{Events: slices.Clone(state.Events)}
+	if clone.Events == nil {
+		clone.Events = []domain.DrawEvent{}
+	}
+	for _, image := range state.Images {
+		copied := *image
+		clone.Images = append(clone.Images, &copied)
+	}
+	return clone
+}
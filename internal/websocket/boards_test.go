@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+)
+
+// boardRepo stores boards in memory. Saves block until release is closed.
+type boardRepo struct {
+	repository.Repository
+
+	release chan struct{}
+
+	mu     sync.Mutex
+	boards map[string]*domain.WhiteboardState
+	saves  int
+}
+
+func (r *boardRepo) GetWhiteboardState(_ context.Context, roomID string) (*domain.WhiteboardState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state, ok := r.boards[roomID]; ok {
+		return state, nil
+	}
+	return &domain.WhiteboardState{Events: []domain.DrawEvent{}}, nil
+}
+
+func (r *boardRepo) SaveWhiteboardState(_ context.Context, roomID string, state *domain.WhiteboardState) error {
+	<-r.release
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.boards[roomID] = state
+	r.saves++
+	return nil
+}
+
+func boardWithImage(id string) *domain.WhiteboardState {
+	return &domain.WhiteboardState{Events: []domain.DrawEvent{}, Images: []*domain.WhiteboardImage{{ID: id}}}
+}
+
+func imageID(t *testing.T, state *domain.WhiteboardState) string {
+	t.Helper()
+	if len(state.Images) != 1 {
+		t.Fatalf("board has %d images, want 1", len(state.Images))
+	}
+	return state.Images[0].ID
+}
+
+func TestBoardSaver(t *testing.T) {
+	repo := &boardRepo{release: make(chan struct{}), boards: make(map[string]*domain.WhiteboardState)}
+	saver := newBoardSaver(repo)
+	go saver.run()
+	ctx := context.Background()
+
+	saver.save("r1", boardWithImage("first"))
+	saver.save("r1", boardWithImage("second"))
+
+	// Snapshots not written yet are seen by loads, as copies.
+	loaded, version, err := saver.load(ctx, "r1")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if version != saver.version("r1") {
+		t.Errorf("loaded version %d, want the current version %d", version, saver.version("r1"))
+	}
+	if got := imageID(t, loaded); got != "second" {
+		t.Errorf("loaded image %q, want the latest snapshot", got)
+	}
+	loaded.Images[0].ID = "changed"
+	if again, _, _ := saver.load(ctx, "r1"); imageID(t, again) != "second" {
+		t.Error("changing a loaded board changed the pending snapshot")
+	}
+
+	// Scheduling a snapshot makes boards loaded before it out of date.
+	saver.save("r1", boardWithImage("third"))
+	if saver.version("r1") == version {
+		t.Error("scheduling a snapshot did not change the version")
+	}
+
+	close(repo.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		saver.mu.Lock()
+		pending := len(saver.pending)
+		saver.mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("snapshots were not written")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if got := imageID(t, repo.boards["r1"]); got != "third" {
+		t.Errorf("stored image %q, want the latest snapshot", got)
+	}
+	if repo.saves > 3 {
+		t.Errorf("%d saves for 3 snapshots", repo.saves)
+	}
+}
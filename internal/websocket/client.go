@@ -1,34 +1,89 @@
 package websocket
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/ratelimit"
 	"github.com/gorilla/websocket"
 	"golang.org/x/time/rate"
 )
 
 const (
-	writeWait      = 10 * time.Second
-	pongWait       = 60 * time.Second
-	pingPeriod     = (pongWait * 9) / 10
-	maxMessageSize = 512
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+	// maxMessageSize fits a message of richtext.MaxLength characters with room to
+	// spare. Larger frames close the connection with 1009 (message too big).
+	maxMessageSize = 32 << 10
 )
 
+// Application close codes. Clients that keep sending invalid messages or exceeding
+// their rate limits are closed with the standard 1008 (policy violation) instead.
+const (
+	closeSessionExpired = 4000
+	closeKicked         = 4001
+	closeDisconnected   = 4002
+	closeBanned         = 4003
+	closeRoomClosed     = 4004
+)
+
+// mutedTypes lists the message types a muted user may not send to their room.
+var mutedTypes = map[string]bool{
+	"text_message": true,
+	"attachment":   true,
+	"edit_message": true,
+}
+
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
 	hub *Hub
 
-	ID       string
-	Username string
-	RoomID   string
+	ID         string
+	Username   string
+	RoomID     string
+	RemoteAddr string
+
+	// ConnID identifies this connection among all the connections of its user.
+	ConnID      string
+	ConnectedAt time.Time
+
+	// expiresAt is the expiry of the token the client authenticated with, if any.
+	expiresAt time.Time
 
-	conn    *websocket.Conn
-	send    chan []byte
-	limiter *rate.Limiter
+	conn *websocket.Conn
+	send chan frame
+
+	// limiters holds the rate limiter of each rate class; nil limiters are unlimited.
+	limiters map[string]*rate.Limiter
+
+	// release frees the connection slots the client holds for its user and address.
+	release func()
+
+	// protocol is the protocol version the client speaks, codec how messages are
+	// encoded for it, and negotiated is set once the client chose them. They are
+	// owned by the hub.
+	protocol   int
+	codec      string
+	negotiated bool
+
+	// violations counts the invalid messages and the messages over the rate limits
+	// since violationsSince, and no rate_limited error is sent before
+	// rateLimitedUntil. They are only used by readPump.
+	violations       int
+	violationsSince  time.Time
+	rateLimitedUntil time.Time
+
+	// mutedUntil is the end of the client's mute in its room as Unix nanoseconds, or 0.
+	// It is written by the hub and read by readPump.
+	mutedUntil atomic.Int64
+
+	// closeFrame, when set by the hub before it closes send, is the close message
+	// writePump sends before closing the connection.
+	closeFrame []byte
 }
 
 // readPump pumps messages from the WebSocket connection to the hub.
@@ -36,6 +91,7 @@ func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
 		c.conn.Close() // Close the connection on exit.
+		c.release()
 	}()
 	c.conn.SetReadLimit(maxMessageSize)
 	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -45,45 +101,81 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		if err := c.limiter.Wait(context.Background()); err != nil {
-			slog.Error("Rate limiter wait error", "error", err, "clientID", c.ID)
-			break
-		}
-
-		_, rawMessage, err := c.conn.ReadMessage()
+		messageType, rawMessage, err := c.conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				// The connection already answered with 1009 (message too big).
+				slog.Warn("Client sent an oversized message", "clientID", c.ID, "remoteAddr", c.RemoteAddr)
+			} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				slog.Warn("Unexpected WebSocket close error", "error", err, "clientID", c.ID)
 			}
 			break
 		}
+		if !c.expiresAt.IsZero() && time.Now().After(c.expiresAt) {
+			c.closeNow(closeSessionExpired, "session expired")
+			break
+		}
 
-		var msg domain.Message
-		if err := json.Unmarshal(rawMessage, &msg); err == nil {
-			switch msg.Type {
-			case "direct_message":
-				var dmPayload domain.DirectMessagePayload
-				payloadBytes, _ := json.Marshal(msg.Payload)
-				if err := json.Unmarshal(payloadBytes, &dmPayload); err == nil {
-					msg.Sender = c.ID
-					msg.Payload = dmPayload
-					c.hub.broadcast <- &msg
-				}
-			case "draw_start", "draw_move", "draw_end", "clear_board", "typing_start", "typing_stop":
-				msg.Sender = c.ID
-				msg.RoomID = c.RoomID
-				c.hub.broadcast <- &msg
-			default:
-				// If the type is unknown but it's valid JSON, we assume it's a text message.
-				// This handles the case where the client sends `{"type":"text_message", "payload":"..."}`
-				if textPayload, ok := msg.Payload.(string); ok {
-					c.sendRoomMessage([]byte(textPayload))
+		if messageType == websocket.BinaryMessage {
+			// Binary frames are MessagePack.
+			if rawMessage, err = msgpackToJSON(rawMessage); err != nil {
+				if c.violate() {
+					break
 				}
+				c.reject("", domain.ErrorInvalidPayload, "invalid MessagePack message")
+				continue
+			}
+		}
+
+		// The envelope is decoded first, then the payload into the type registered for
+		// the message type.
+		var frame inboundFrame
+		if err := decodeFrame(rawMessage, &frame); err != nil {
+			if c.violate() {
+				break
+			}
+			c.reject("", domain.ErrorInvalidPayload, "invalid message format")
+			continue
+		}
+		ok, closed := c.allow(frame.Type, frame.ClientMsgID)
+		if closed {
+			break
+		}
+		if !ok {
+			continue
+		}
+		spec, known := inboundTypes[frame.Type]
+		if !known {
+			c.reject(frame.ClientMsgID, domain.ErrorUnknownType, "unknown message type")
+			continue
+		}
+		if mutedTypes[frame.Type] {
+			if until := c.mutedUntilTime(); !until.IsZero() {
+				c.reject(frame.ClientMsgID, domain.ErrorUnauthorized, "you are muted until "+until.UTC().Format(time.RFC3339))
+				continue
 			}
-		} else {
-			// If it's not valid JSON, treat as a plain text message for the room.
-			c.sendRoomMessage(rawMessage)
 		}
+
+		// IDs, timestamps, sender details, rendered content and attachment details are
+		// assigned by the server, never by clients.
+		msg := &domain.Message{
+			Type:        frame.Type,
+			Sender:      c.ID,
+			SenderName:  c.Username,
+			ClientMsgID: frame.ClientMsgID,
+			ParentID:    frame.ParentID,
+		}
+		if spec.room {
+			msg.RoomID = c.RoomID
+		}
+		if err := spec.decode(msg, frame.Payload); err != nil {
+			if c.violate() {
+				break
+			}
+			c.reject(frame.ClientMsgID, errorCode(err), err.Error())
+			continue
+		}
+		c.hub.broadcast <- &inboundMessage{client: c, msg: msg}
 	}
 }
 
@@ -98,10 +190,21 @@ func (c *Client) writePump() {
 		case message, ok := <-c.send:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				_ = c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// The hub removed the client: say goodbye and drop the connection, which
+				// also stops readPump.
+				closeFrame := c.closeFrame
+				if closeFrame == nil {
+					closeFrame = []byte{}
+				}
+				_ = c.conn.WriteMessage(websocket.CloseMessage, closeFrame)
+				c.conn.Close()
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			messageType := websocket.TextMessage
+			if message.binary {
+				messageType = websocket.BinaryMessage
+			}
+			if err := c.conn.WriteMessage(messageType, message.data); err != nil {
 				return // Exit on write error
 			}
 		case <-ticker.C:
@@ -113,13 +216,93 @@ func (c *Client) writePump() {
 	}
 }
 
-// sendRoomMessage is a helper to create and send a standard text message to the hub.
-func (c *Client) sendRoomMessage(rawMessage []byte) {
-	roomMsg := &domain.Message{
-		Type:    "text_message",
-		Payload: string(rawMessage),
-		Sender:  c.ID,
-		RoomID:  c.RoomID,
+// reject asks the hub to tell this client that one of its messages was refused, with
+// one of the domain.Error* codes. Errors go through the hub because only the hub may
+// write to the send channel.
+func (c *Client) reject(clientMsgID, code, reason string) {
+	c.sendRejection(&domain.ErrorPayload{ClientMsgID: clientMsgID, Code: code, Message: reason})
+}
+
+// sendRejection asks the hub to send an error payload to this client.
+func (c *Client) sendRejection(payload *domain.ErrorPayload) {
+	c.hub.broadcast <- &inboundMessage{
+		client:    c,
+		msg:       &domain.Message{ClientMsgID: payload.ClientMsgID},
+		rejection: payload,
+	}
+}
+
+// allow reports whether the client may send a message of the given type now. Over
+// the limit, the first message is rejected with a `rate_limited` error telling the
+// client how long to wait, and the following ones are dropped until then. A client
+// that keeps exceeding its limits is disconnected, in which case allow returns false
+// and closed is set. Only readPump may call allow.
+func (c *Client) allow(msgType, clientMsgID string) (ok, closed bool) {
+	class := rateClass(msgType)
+	ok, retryAfter := ratelimit.Allow(c.limiters[class])
+	if ok {
+		return true, false
+	}
+	rateLimitedMessages.Add(class, 1)
+	if c.violate() {
+		return false, true
+	}
+
+	now := time.Now()
+	if now.Before(c.rateLimitedUntil) {
+		return false, false
+	}
+	c.rateLimitedUntil = now.Add(retryAfter)
+	c.sendRejection(&domain.ErrorPayload{
+		ClientMsgID:  clientMsgID,
+		Code:         domain.ErrorRateLimited,
+		Message:      "too many messages",
+		RetryAfterMs: max(retryAfter.Milliseconds(), 1),
+	})
+	return false, false
+}
+
+// violate counts an invalid message or a message over the rate limits. Once the
+// client exceeded MaxViolations within ViolationWindow, violate closes the connection
+// with 1008 (policy violation) and returns true. Only readPump may call violate.
+func (c *Client) violate() bool {
+	now := time.Now()
+	if now.Sub(c.violationsSince) > c.hub.rates.ViolationWindow {
+		c.violationsSince, c.violations = now, 0
+	}
+	c.violations++
+	limit := c.hub.rates.MaxViolations
+	if limit <= 0 || c.violations <= limit {
+		return false
+	}
+	policyDisconnects.Add(1)
+	slog.Warn("Disconnecting client for violating the protocol or its rate limits", "clientID", c.ID, "roomID", c.RoomID, "remoteAddr", c.RemoteAddr)
+	c.closeNow(websocket.ClosePolicyViolation, "too many invalid or rate limited messages")
+	return true
+}
+
+// closeNow sends a close message to the client from readPump, which then stops and
+// drops the connection. Close messages may be written concurrently with writePump.
+func (c *Client) closeNow(code int, text string) {
+	closeFrame := websocket.FormatCloseMessage(code, text)
+	_ = c.conn.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(writeWait))
+}
+
+// setMutedUntil records the end of the client's mute; the zero time unmutes it.
+func (c *Client) setMutedUntil(t time.Time) {
+	if t.IsZero() {
+		c.mutedUntil.Store(0)
+		return
+	}
+	c.mutedUntil.Store(t.UnixNano())
+}
+
+// mutedUntilTime returns the end of the client's mute, or the zero time if it is not
+// muted (anymore).
+func (c *Client) mutedUntilTime() time.Time {
+	until := c.mutedUntil.Load()
+	if until == 0 || time.Now().UnixNano() >= until {
+		return time.Time{}
 	}
-	c.hub.broadcast <- roomMsg
+	return time.Unix(0, until)
 }
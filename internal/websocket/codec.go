@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codecs encode the messages sent to clients. JSON, sent as text frames, is the
+// default. MessagePack, sent as binary frames, is negotiated per connection by clients
+// that draw a lot: messages are maps with the keys of their JSON encoding, except for
+// the drawing events, which make up most of the traffic and are sent as compact arrays
+// (see encodeDrawEvent).
+const (
+	codecJSON    = "json"
+	codecMsgpack = "msgpack"
+)
+
+// codec encodes messages for the clients using it.
+type codec struct {
+	binary bool
+	encode func(msg *domain.Message) ([]byte, error)
+}
+
+// codecs lists the supported codecs.
+var codecs = map[string]codec{
+	codecJSON:    {encode: encodeJSON},
+	codecMsgpack: {binary: true, encode: encodeMsgpack},
+}
+
+// codecNames lists the supported codecs, preferred first.
+var codecNames = []string{codecMsgpack, codecJSON}
+
+// frame is an encoded message queued for a client.
+type frame struct {
+	data   []byte
+	binary bool
+}
+
+// encodeJSON encodes a message as JSON.
+func encodeJSON(msg *domain.Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// encodeMsgpack encodes a message as MessagePack, with the field names and omitted
+// empty fields of its JSON encoding, or as an array for drawing events.
+func encodeMsgpack(msg *domain.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(enc)
+	enc.Reset(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	var err error
+	if isDrawType(msg.Type) {
+		err = encodeDrawEvent(enc, msg)
+	} else {
+		err = enc.Encode(msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isDrawType reports whether msgType is one of the events of a stroke.
+func isDrawType(msgType string) bool {
+	return msgType == "draw_start" || msgType == "draw_move" || msgType == "draw_end"
+}
+
+// encodeDrawEvent encodes a drawing event as the array
+//
+//	[type, seq, sender, x, y, color, lineWidth]
+//
+// leaving out the room, which is the client's own, and the sender's name, which is in
+// the room's user list. `draw_end` has no payload and stops after the sender.
+func encodeDrawEvent(enc *msgpack.Encoder, msg *domain.Message) error {
+	p, ok := msg.Payload.(domain.DrawEventPayload)
+	n := 7
+	if !ok {
+		n = 3
+	}
+	err := errors.Join(
+		enc.EncodeArrayLen(n),
+		enc.EncodeString(msg.Type),
+		enc.EncodeInt(msg.Seq),
+		enc.EncodeString(msg.Sender),
+	)
+	if err != nil || !ok {
+		return err
+	}
+	return errors.Join(
+		enc.EncodeFloat64(p.X),
+		enc.EncodeFloat64(p.Y),
+		enc.EncodeString(p.Color),
+		enc.EncodeFloat64(p.LineWidth),
+	)
+}
+
+// msgpackToJSON converts a MessagePack frame sent by a client into JSON, so that
+// binary frames go through the same strict decoding and validation as text frames.
+func msgpackToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]any); !ok {
+		return nil, fmt.Errorf("message must be a map, got %T", v)
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// benchRoomSize is the number of clients of the room in the broadcast benchmarks,
+// half of which use each codec.
+const benchRoomSize = 50
+
+// benchDrawMove returns a typical `draw_move` broadcast.
+func benchDrawMove() *domain.Message {
+	return &domain.Message{
+		Type: "draw_move",
+		Payload: domain.DrawEventPayload{
+			X:         512.5,
+			Y:         384.25,
+			Color:     "#2f8f5b",
+			LineWidth: 4,
+		},
+		Sender:     "5f0c6a2e-6f5d-4b7a-9a51-1c0d7e3f2b84",
+		SenderName: "alice",
+		RoomID:     "general",
+		Seq:        1024,
+		Timestamp:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func benchmarkEncode(b *testing.B, codecName string) {
+	msg := benchDrawMove()
+	encode := codecs[codecName].encode
+	data, err := encode(msg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := encode(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes/frame")
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	benchmarkEncode(b, codecJSON)
+}
+
+func BenchmarkEncodeMsgpack(b *testing.B) {
+	benchmarkEncode(b, codecMsgpack)
+}
+
+// BenchmarkBroadcast compares encoding a `draw_move` broadcast for every client of a
+// room with encoding it once per codec, as the hub does.
+func BenchmarkBroadcast(b *testing.B) {
+	msg := benchDrawMove()
+	room := make([]*Client, benchRoomSize)
+	for i := range room {
+		room[i] = &Client{protocol: protocolV2, codec: codecNames[i%len(codecNames)]}
+	}
+
+	b.Run(fmt.Sprintf("clients=%d/per-recipient", benchRoomSize), func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			for _, c := range room {
+				if _, err := codecs[c.codec].encode(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run(fmt.Sprintf("clients=%d/per-codec", benchRoomSize), func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			enc := newMessageEncoder(msg)
+			for _, c := range room {
+				if _, ok := enc.frame(c); !ok {
+					b.Fatal("message not encoded")
+				}
+			}
+		}
+	})
+}
+
+func TestEncodeMsgpackDrawEvent(t *testing.T) {
+	end := &domain.Message{Type: "draw_end", Sender: "u1", Seq: 7}
+	tests := []struct {
+		msg  *domain.Message
+		want []any
+	}{
+		{msg: benchDrawMove(), want: []any{"draw_move", 1024.0, "5f0c6a2e-6f5d-4b7a-9a51-1c0d7e3f2b84", 512.5, 384.25, "#2f8f5b", 4.0}},
+		{msg: end, want: []any{"draw_end", 7.0, "u1"}},
+	}
+	for _, tt := range tests {
+		data, err := encodeMsgpack(tt.msg)
+		if err != nil {
+			t.Fatalf("encodeMsgpack(%s): %v", tt.msg.Type, err)
+		}
+		var got []any
+		if err := msgpack.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s is not an array: %v", tt.msg.Type, err)
+		}
+		for i, v := range got {
+			// Numbers are encoded in their most compact form, whole floats as integers.
+			switch n := v.(type) {
+			case int8:
+				got[i] = float64(n)
+			case uint8:
+				got[i] = float64(n)
+			case int16:
+				got[i] = float64(n)
+			case uint16:
+				got[i] = float64(n)
+			case float32:
+				got[i] = float64(n)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("encodeMsgpack(%s) = %#v, want %#v", tt.msg.Type, got, tt.want)
+		}
+	}
+}
+
+func TestMsgpackToJSON(t *testing.T) {
+	msg := func() *domain.Message {
+		return &domain.Message{Type: "text_message", Payload: "hi", ClientMsgID: "c1", ParentID: 3}
+	}
+	data, err := encodeMsgpack(msg())
+	if err != nil {
+		t.Fatalf("encodeMsgpack: %v", err)
+	}
+	converted, err := msgpackToJSON(data)
+	if err != nil {
+		t.Fatalf("msgpackToJSON: %v", err)
+	}
+	encoded, err := encodeJSON(msg())
+	if err != nil {
+		t.Fatalf("encodeJSON: %v", err)
+	}
+	var got, want any
+	if err := json.Unmarshal(converted, &got); err != nil {
+		t.Fatalf("msgpackToJSON returned invalid JSON %s: %v", converted, err)
+	}
+	if err := json.Unmarshal(encoded, &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("msgpackToJSON = %s, want %s", converted, encoded)
+	}
+
+	if _, err := msgpackToJSON([]byte{0x93, 1, 2, 3}); err == nil {
+		t.Error("msgpackToJSON accepted an array")
+	}
+}
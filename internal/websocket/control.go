@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/gorilla/websocket"
+)
+
+// ClientInfo describes a live connection for the admin API.
+type ClientInfo struct {
+	ConnID      string    `json:"conn_id"`
+	UserID      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	RoomID      string    `json:"room_id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+
+	// SendQueue is the number of messages waiting to be written to the client, out of
+	// SendQueueCap. A queue that stays full is a sign of a slow consumer.
+	SendQueue    int `json:"send_queue"`
+	SendQueueCap int `json:"send_queue_cap"`
+}
+
+// do runs cmd on the hub's goroutine and waits for it to finish, so that cmd may
+// safely read and modify the hub's state.
+func (h *Hub) do(cmd func()) {
+	done := make(chan struct{})
+	h.commands <- func() {
+		defer close(done)
+		cmd()
+	}
+	<-done
+}
+
+// ListClients is a thread-safe method to get the clients connected to a room, or to
+// any room if roomID is empty, ordered by room and connection time.
+func (h *Hub) ListClients(roomID string) []ClientInfo {
+	clients := []ClientInfo{}
+	h.do(func() {
+		for id, room := range h.rooms {
+			if roomID != "" && id != roomID {
+				continue
+			}
+			for c := range room {
+				clients = append(clients, ClientInfo{
+					ConnID:       c.ConnID,
+					UserID:       c.ID,
+					Username:     c.Username,
+					RoomID:       c.RoomID,
+					RemoteAddr:   c.RemoteAddr,
+					ConnectedAt:  c.ConnectedAt,
+					SendQueue:    len(c.send),
+					SendQueueCap: cap(c.send),
+				})
+			}
+		}
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].RoomID != clients[j].RoomID {
+			return clients[i].RoomID < clients[j].RoomID
+		}
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	return clients
+}
+
+// DisconnectClient is a thread-safe method to close a single connection. It returns
+// the connection that was closed, or nil if there is no such connection.
+func (h *Hub) DisconnectClient(connID string) *ClientInfo {
+	var info *ClientInfo
+	h.do(func() {
+		for _, room := range h.rooms {
+			for c := range room {
+				if c.ConnID != connID {
+					continue
+				}
+				info = &ClientInfo{ConnID: c.ConnID, UserID: c.ID, Username: c.Username, RoomID: c.RoomID}
+				c.closeFrame = websocket.FormatCloseMessage(closeDisconnected, "disconnected by an administrator")
+				h.removeClient(c)
+				return
+			}
+		}
+	})
+	return info
+}
+
+// CloseRoom is a thread-safe method to disconnect every client of a room. It returns
+// the number of clients disconnected.
+func (h *Hub) CloseRoom(roomID string) int {
+	var n int
+	h.do(func() {
+		closeFrame := websocket.FormatCloseMessage(closeRoomClosed, "room closed by an administrator")
+		for c := range h.rooms[roomID] {
+			c.closeFrame = closeFrame
+			h.removeClient(c)
+			n++
+		}
+	})
+	return n
+}
+
+// Announce is a thread-safe method to broadcast a system announcement to a room, or
+// to every room if roomID is empty. It returns the number of rooms reached.
+func (h *Hub) Announce(roomID string, announcement domain.AnnouncementPayload) int {
+	var n int
+	h.do(func() {
+		for id := range h.rooms {
+			if roomID != "" && id != roomID {
+				continue
+			}
+			h.broadcastToRoom(&domain.Message{
+				Type:      "system_announcement",
+				RoomID:    id,
+				Timestamp: time.Now(),
+				Payload:   announcement,
+			})
+			n++
+		}
+	})
+	return n
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+)
+
+// routeGroupMessage stores a group conversation message, acknowledges it to the
+// sender and fans it out to every connection of every participant, whatever room
+// those connections belong to.
+func (h *Hub) routeGroupMessage(sender *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.GroupMessagePayload)
+	if !ok {
+		return
+	}
+
+	memberIDs, err := h.repo.GetConversationMemberIDs(context.Background(), payload.ConversationID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("Failed to load conversation members", "error", err, "conversationID", payload.ConversationID)
+		h.sendError(sender, message.ClientMsgID, domain.ErrorInternal, "group message could not be saved")
+		return
+	}
+	if !slices.Contains(memberIDs, message.Sender) {
+		h.sendError(sender, message.ClientMsgID, domain.ErrorUnauthorized, "not a participant of this conversation")
+		return
+	}
+
+	gm := &domain.GroupMessage{
+		ConversationID: payload.ConversationID,
+		SenderID:       message.Sender,
+		SenderName:     message.SenderName,
+		Content:        payload.Content,
+		ClientMsgID:    message.ClientMsgID,
+	}
+	err = h.repo.SaveGroupMessage(context.Background(), gm)
+	if errors.Is(err, repository.ErrDuplicateMessage) {
+		h.sendAck(sender, gm.ClientMsgID, gm.ID, gm.Timestamp, true)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to save group message", "error", err)
+		h.sendError(sender, gm.ClientMsgID, domain.ErrorInternal, "group message could not be saved")
+		return
+	}
+	h.sendAck(sender, gm.ClientMsgID, gm.ID, gm.Timestamp, false)
+
+	h.notifyUsers(memberIDs, &domain.Message{
+		Type:        "group_message",
+		Payload:     domain.GroupMessagePayload{ConversationID: gm.ConversationID, Content: gm.Content},
+		Sender:      gm.SenderID,
+		SenderName:  gm.SenderName,
+		ID:          gm.ID,
+		Timestamp:   gm.Timestamp,
+		ClientMsgID: gm.ClientMsgID,
+	})
+}
@@ -0,0 +1,181 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+)
+
+// pendingDirectMessageLimit caps how many undelivered direct messages are pushed to
+// a client when it connects. The rest are delivered on its next connection or can be
+// fetched through the REST API.
+const pendingDirectMessageLimit = 100
+
+// routeDirectMessage stores a direct message, acknowledges it to the sender and
+// delivers it to every connection of the recipient. The sender is told with
+// `dm_delivered` once a recipient connection accepted it, or with `dm_failed` if
+// the recipient does not exist or none of its connections could take the message.
+func (h *Hub) routeDirectMessage(sender *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.DirectMessagePayload)
+	if !ok {
+		return
+	}
+
+	if _, err := h.repo.FindUserByID(context.Background(), payload.RecipientID); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Failed to look up direct message recipient", "error", err, "recipientID", payload.RecipientID)
+		}
+		h.sendDirectMessageFailed(sender, &domain.DirectMessageFailedPayload{
+			ClientMsgID: message.ClientMsgID,
+			RecipientID: payload.RecipientID,
+			Reason:      "unknown_recipient",
+		})
+		return
+	}
+
+	dm := &domain.DirectMessage{
+		SenderID:    message.Sender,
+		SenderName:  message.SenderName,
+		RecipientID: payload.RecipientID,
+		Content:     payload.Content,
+		ClientMsgID: message.ClientMsgID,
+	}
+	err := h.repo.SaveDirectMessage(context.Background(), dm)
+	if errors.Is(err, repository.ErrDuplicateMessage) {
+		h.sendAck(sender, dm.ClientMsgID, dm.ID, dm.Timestamp, true)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to save direct message", "error", err)
+		h.sendDirectMessageFailed(sender, &domain.DirectMessageFailedPayload{
+			ClientMsgID: dm.ClientMsgID,
+			RecipientID: dm.RecipientID,
+			Reason:      "not_stored",
+		})
+		return
+	}
+	h.sendAck(sender, dm.ClientMsgID, dm.ID, dm.Timestamp, false)
+
+	if _, online := h.clients[dm.RecipientID]; !online {
+		// The message stays pending until the recipient connects.
+		return
+	}
+	if !h.deliverDirectMessage(dm) {
+		slog.Warn("Failed to send DM, recipient channels full", "recipientID", dm.RecipientID)
+		h.sendDirectMessageFailed(sender, &domain.DirectMessageFailedPayload{
+			ClientMsgID: dm.ClientMsgID,
+			MessageID:   dm.ID,
+			RecipientID: dm.RecipientID,
+			Reason:      "recipient_unreachable",
+		})
+		return
+	}
+	h.markDelivered([]*domain.DirectMessage{dm})
+}
+
+// deliverDirectMessage sends a stored direct message to all connections of its
+// recipient and reports whether at least one of them accepted it.
+func (h *Hub) deliverDirectMessage(dm *domain.DirectMessage) bool {
+	msg := directMessageEvent(dm)
+	delivered := false
+	for c := range h.clients[dm.RecipientID] {
+		if h.sendToClient(c, msg) {
+			delivered = true
+		}
+	}
+	return delivered
+}
+
+// deliverPendingDirectMessages pushes the direct messages a user received while
+// offline, loaded before registration, to a newly registered connection.
+func (h *Hub) deliverPendingDirectMessages(c *Client, pending []*domain.DirectMessage) {
+	delivered := make([]*domain.DirectMessage, 0, len(pending))
+	for _, dm := range pending {
+		if !h.sendToClient(c, directMessageEvent(dm)) {
+			break
+		}
+		delivered = append(delivered, dm)
+	}
+	h.markDelivered(delivered)
+}
+
+// markDelivered records that direct messages reached their recipient and notifies
+// their senders with `dm_delivered`.
+func (h *Hub) markDelivered(dms []*domain.DirectMessage) {
+	if len(dms) == 0 {
+		return
+	}
+	ids := make([]int64, len(dms))
+	for i, dm := range dms {
+		ids[i] = dm.ID
+	}
+	if err := h.repo.MarkDirectMessagesDelivered(context.Background(), ids); err != nil {
+		slog.Error("Failed to mark direct messages delivered", "error", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, dm := range dms {
+		msg := &domain.Message{
+			Type: "dm_delivered",
+			Payload: domain.DirectMessageDeliveredPayload{
+				MessageID:   dm.ID,
+				RecipientID: dm.RecipientID,
+				DeliveredAt: now,
+			},
+		}
+		h.notifyUsers([]string{dm.SenderID}, msg)
+	}
+}
+
+// handleDirectMessageRead persists a read pointer sent by a client over its socket
+// and forwards the receipt to the other participant.
+func (h *Hub) handleDirectMessageRead(reader *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.DirectMessageReadPayload)
+	if !ok {
+		return
+	}
+	err := h.repo.MarkDirectConversationRead(context.Background(), message.Sender, payload.PeerID, payload.LastReadID)
+	if err != nil {
+		slog.Error("Failed to mark direct messages read", "error", err, "userID", message.Sender, "peerID", payload.PeerID)
+		h.sendError(reader, message.ClientMsgID, domain.ErrorInternal, "read receipt could not be saved")
+		return
+	}
+	h.notifyUsers([]string{payload.PeerID}, readReceiptEvent(message.Sender, payload.LastReadID))
+}
+
+// NotifyDirectMessagesRead is a thread-safe method to forward a read pointer that was
+// persisted outside the hub, such as through the REST API, to the other participant.
+func (h *Hub) NotifyDirectMessagesRead(readerID, peerID string, lastReadID int64) {
+	h.NotifyUsers([]string{peerID}, readReceiptEvent(readerID, lastReadID))
+}
+
+// readReceiptEvent builds the `dm_read` message telling a participant how far the
+// reader has read their conversation.
+func readReceiptEvent(readerID string, lastReadID int64) *domain.Message {
+	return &domain.Message{
+		Type:    "dm_read",
+		Payload: domain.DirectMessageReadPayload{PeerID: readerID, LastReadID: lastReadID},
+	}
+}
+
+// sendDirectMessageFailed tells a sender that its direct message could not be delivered.
+func (h *Hub) sendDirectMessageFailed(c *Client, payload *domain.DirectMessageFailedPayload) {
+	h.sendToClient(c, &domain.Message{Type: "dm_failed", Payload: payload})
+}
+
+// directMessageEvent builds the message a recipient receives for a stored direct message.
+func directMessageEvent(dm *domain.DirectMessage) *domain.Message {
+	return &domain.Message{
+		Type:       "direct_message",
+		Payload:    dm.Content,
+		Sender:     dm.SenderID,
+		SenderName: dm.SenderName,
+		ID:         dm.ID,
+		Timestamp:  dm.Timestamp,
+	}
+}
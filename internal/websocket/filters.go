@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/filter"
+	"github.com/Lec7ral/WithWebSocket/internal/richtext"
+)
+
+// filterMessage runs the content of a chat message through the hub's filters. It
+// reports false if the message was rejected, in which case the sender was told why.
+// Masked content replaces the message content, and the reasons the message was
+// flagged for are returned so they can be recorded once the message is stored.
+func (h *Hub) filterMessage(c *Client, message *domain.Message) (flags []string, ok bool) {
+	content, _ := message.Payload.(string)
+	content, flags, ok = h.filterContent(c, message, content)
+	if ok {
+		message.Payload = content
+	}
+	return flags, ok
+}
+
+// filterContent runs content a client sent with a message, such as a new chat
+// message or the new content of an edited one, through the hub's filters. It returns
+// the content to store, masked if needed, with message.HTML rendered to match, and
+// the reasons to flag it for. It reports false if the content was rejected, in which
+// case the sender was told why.
+func (h *Hub) filterContent(c *Client, message *domain.Message, content string) (string, []string, bool) {
+	if content == "" || len(h.filters) == 0 {
+		return content, nil, true
+	}
+
+	result := h.filters.Apply(filter.Message{
+		RoomID:   message.RoomID,
+		SenderID: c.ID,
+		Content:  content,
+		Edit:     message.Type == "edit_message",
+	})
+	if result.Rejected {
+		slog.Debug("Message rejected by filters", "clientID", c.ID, "roomID", message.RoomID, "reason", result.Reason)
+		h.sendError(c, message.ClientMsgID, domain.ErrorContentRejected, result.Reason)
+		return "", nil, false
+	}
+	if result.Masked {
+		masked, err := richtext.Parse(result.Content)
+		if err != nil {
+			h.sendError(c, message.ClientMsgID, domain.ErrorContentRejected, result.Reason)
+			return "", nil, false
+		}
+		content = masked.Source
+		message.HTML = masked.HTML
+		h.sendFilterNotice(c, message, filter.Mask, result.Reason)
+	}
+	return content, result.Flags, true
+}
+
+// flagMessage records the reasons a stored chat message was flagged for, so that
+// moderators can review it, and tells its sender.
+func (h *Hub) flagMessage(c *Client, message *domain.Message, flags []string) {
+	if len(flags) == 0 {
+		return
+	}
+	if err := h.repo.FlagMessage(context.Background(), message.ID, flags); err != nil {
+		slog.Error("Failed to flag message", "error", err, "messageID", message.ID)
+	}
+	h.sendFilterNotice(c, message, filter.Flag, strings.Join(flags, "; "))
+}
+
+// sendFilterNotice tells a client that the filters masked or flagged one of its messages.
+func (h *Hub) sendFilterNotice(c *Client, message *domain.Message, action filter.Action, reason string) {
+	h.sendToClient(c, &domain.Message{
+		Type: "message_filtered",
+		Payload: domain.FilterNoticePayload{
+			ClientMsgID: message.ClientMsgID,
+			MessageID:   message.ID,
+			Action:      action.String(),
+			Reason:      reason,
+		},
+	})
+}
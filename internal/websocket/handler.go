@@ -1,11 +1,23 @@
 package websocket
 
 import (
+	"cmp"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/Lec7ral/WithWebSocket/internal/audit"
 	"github.com/Lec7ral/WithWebSocket/internal/auth"
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/ratelimit"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+	"github.com/Lec7ral/WithWebSocket/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
 )
@@ -13,20 +25,57 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	Subprotocols:    subprotocols,
 	CheckOrigin: func(_ *http.Request) bool {
 		return true
 	},
 }
 
+// defaultHistoryLimit and maxHistoryLimit bound the number of messages returned by
+// the chat history endpoint.
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+// maxSearchLength and maxSearchOffset bound the search text and how deep clients
+// can page through search results.
+const (
+	maxSearchLength = 200
+	maxSearchOffset = 1000
+)
+
+// minGroupParticipants and maxGroupParticipants bound the size of group conversations,
+// including their creator. Smaller conversations are plain direct messages.
+const (
+	minGroupParticipants = 3
+	maxGroupParticipants = 50
+)
+
 type Handler struct {
 	hub         *Hub
 	authService *auth.Service
+	repo        repository.Repository
+
+	// blobs stores uploaded attachments of at most maxUploadSize bytes.
+	blobs         storage.BlobStore
+	maxUploadSize int64
+
+	// userConns and ipConns count the open WebSocket connections of each user and
+	// IP address.
+	userConns *ratelimit.ConnLimiter
+	ipConns   *ratelimit.ConnLimiter
 }
 
-func NewHandler(hub *Hub, authService *auth.Service) *Handler {
+func NewHandler(hub *Hub, authService *auth.Service, repo repository.Repository, blobs storage.BlobStore, maxUploadSize int64, connLimits ConnLimits) *Handler {
 	return &Handler{
-		hub:         hub,
-		authService: authService,
+		hub:           hub,
+		authService:   authService,
+		repo:          repo,
+		blobs:         blobs,
+		maxUploadSize: maxUploadSize,
+		userConns:     ratelimit.NewConnLimiter(connLimits.PerUser),
+		ipConns:       ratelimit.NewConnLimiter(connLimits.PerIP),
 	}
 }
 
@@ -37,7 +86,7 @@ func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	claims, err := h.authService.ValidateToken(tokenString)
+	claims, err := h.authService.ValidateRequestToken(r, tokenString)
 	if err != nil {
 		slog.Warn("Invalid WebSocket token received", "error", err)
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
@@ -50,18 +99,66 @@ func (h *Handler) ServeWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	banned, err := h.repo.IsBanned(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		slog.Error("Failed to check room ban", "error", err, "roomID", roomID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if banned {
+		http.Error(w, "You are banned from this room", http.StatusForbidden)
+		return
+	}
+
+	// A reconnecting client passes the last sequence number it saw to receive the
+	// events it missed instead of the full room state.
+	var since int64
+	sinceParam := r.URL.Query().Get("since")
+	if sinceParam != "" {
+		since, err = strconv.ParseInt(sinceParam, 10, 64)
+		if err != nil || since < 0 {
+			http.Error(w, "Invalid since parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	remoteAddr := audit.RemoteAddr(r)
+	if !h.userConns.Acquire(claims.UserID) {
+		http.Error(w, "Too many connections for this user", http.StatusTooManyRequests)
+		return
+	}
+	if !h.ipConns.Acquire(remoteAddr) {
+		h.userConns.Release(claims.UserID)
+		http.Error(w, "Too many connections from this address", http.StatusTooManyRequests)
+		return
+	}
+	release := func() {
+		h.userConns.Release(claims.UserID)
+		h.ipConns.Release(remoteAddr)
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
+		release()
 		slog.Error("Failed to upgrade connection", "error", err)
 		return
 	}
 
+	protocol, codecName := parseSubprotocol(conn.Subprotocol())
+
 	// The handler's job is just to validate and pass the request to the hub.
 	regReq := &registrationRequest{
-		claims: claims,
-		conn:   conn,
-		roomID: roomID,
+		claims:     claims,
+		conn:       conn,
+		roomID:     roomID,
+		remoteAddr: remoteAddr,
+		release:    release,
+		protocol:   protocol,
+		codec:      codecName,
+		resume:     sinceParam != "",
+		since:      since,
 	}
+	h.hub.prepareRegistration(r.Context(), regReq)
 	h.hub.register <- regReq
 }
 
@@ -74,3 +171,536 @@ func (h *Handler) HandleGetRooms(w http.ResponseWriter, _ *http.Request) {
 		slog.Error("Failed to write rooms response", "error", err)
 	}
 }
+
+// HandleGetRoomMessages is the HTTP handler for the GET /api/rooms/{roomID}/messages endpoint.
+// It returns the most recent chat messages of a room, oldest first, to members of the
+// room.
+func (h *Handler) HandleGetRoomMessages(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	limit, ok := historyLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkRoomMember(w, r, roomID, claims.UserID) {
+		return
+	}
+
+	messages, err := h.repo.GetMessagesByRoom(r.Context(), roomID, limit)
+	if err != nil {
+		slog.Error("Failed to load room messages", "error", err, "roomID", roomID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []*domain.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		slog.Error("Failed to write room messages response", "error", err)
+	}
+}
+
+// HandleGetDirectConversations is the HTTP handler for the GET /api/dms endpoint.
+// It lists the caller's direct message conversations with their unread counts.
+func (h *Handler) HandleGetDirectConversations(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	conversations, err := h.repo.GetDirectConversations(r.Context(), claims.UserID)
+	if err != nil {
+		slog.Error("Failed to load direct conversations", "error", err, "userID", claims.UserID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if conversations == nil {
+		conversations = []*domain.DirectConversation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(conversations); err != nil {
+		slog.Error("Failed to write direct conversations response", "error", err)
+	}
+}
+
+// HandleGetDirectMessages is the HTTP handler for the GET /api/dms/{userID} endpoint.
+// It returns a page of the conversation between the caller and another user, oldest
+// first. Older pages are requested with before set to the smallest ID already seen.
+func (h *Handler) HandleGetDirectMessages(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	peerID := chi.URLParam(r, "userID")
+
+	limit, ok := historyLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	before, ok := historyBefore(r)
+	if !ok {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	messages, err := h.repo.GetDirectMessages(r.Context(), claims.UserID, peerID, before, limit)
+	if err != nil {
+		slog.Error("Failed to load direct messages", "error", err, "userID", claims.UserID, "peerID", peerID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []*domain.DirectMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		slog.Error("Failed to write direct messages response", "error", err)
+	}
+}
+
+// MarkReadRequest defines the structure of a request to mark a conversation as read.
+type MarkReadRequest struct {
+	LastReadID int64 `json:"last_read_id"`
+}
+
+// HandleMarkDirectMessagesRead is the HTTP handler for the POST /api/dms/{userID}/read
+// endpoint. It advances the caller's read pointer in the conversation with another user.
+func (h *Handler) HandleMarkDirectMessagesRead(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	peerID := chi.URLParam(r, "userID")
+
+	var req MarkReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.LastReadID <= 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.MarkDirectConversationRead(r.Context(), claims.UserID, peerID, req.LastReadID); err != nil {
+		slog.Error("Failed to mark direct messages read", "error", err, "userID", claims.UserID, "peerID", peerID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.hub.NotifyDirectMessagesRead(claims.UserID, peerID, req.LastReadID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetThread is the HTTP handler for the GET /api/rooms/{roomID}/messages/{id}/thread
+// endpoint. It returns a message together with a page of its replies, oldest first,
+// to members of the room.
+func (h *Handler) HandleGetThread(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+	messageID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || messageID <= 0 {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	limit, ok := historyLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+	before, ok := historyBefore(r)
+	if !ok {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkRoomMember(w, r, roomID, claims.UserID) {
+		return
+	}
+
+	parent, err := h.repo.GetMessageByID(r.Context(), messageID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("Failed to load thread parent", "error", err, "messageID", messageID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err != nil || parent.RoomID != roomID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	replies, err := h.repo.GetThreadReplies(r.Context(), messageID, before, limit)
+	if err != nil {
+		slog.Error("Failed to load thread replies", "error", err, "messageID", messageID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if replies == nil {
+		replies = []*domain.Message{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(domain.Thread{Parent: parent, Replies: replies}); err != nil {
+		slog.Error("Failed to write thread response", "error", err)
+	}
+}
+
+// HandleGetMentions is the HTTP handler for the GET /api/mentions endpoint.
+// It returns the caller's unread mentions, newest first.
+func (h *Handler) HandleGetMentions(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	limit, ok := historyLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+
+	mentions, err := h.repo.GetUnreadMentions(r.Context(), claims.UserID, limit)
+	if err != nil {
+		slog.Error("Failed to load mentions", "error", err, "userID", claims.UserID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mentions == nil {
+		mentions = []*domain.Mention{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(mentions); err != nil {
+		slog.Error("Failed to write mentions response", "error", err)
+	}
+}
+
+// MarkMentionsReadRequest defines the structure of a request to mark mentions as read.
+// An empty list marks all of the caller's mentions as read.
+type MarkMentionsReadRequest struct {
+	MessageIDs []int64 `json:"message_ids"`
+}
+
+// HandleMarkMentionsRead is the HTTP handler for the POST /api/mentions/read endpoint.
+func (h *Handler) HandleMarkMentionsRead(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	var req MarkMentionsReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.MarkMentionsRead(r.Context(), claims.UserID, req.MessageIDs); err != nil {
+		slog.Error("Failed to mark mentions read", "error", err, "userID", claims.UserID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleGetPins is the HTTP handler for the GET /api/rooms/{roomID}/pins endpoint.
+// It returns the messages pinned to a room, oldest pin first, to members of the room.
+func (h *Handler) HandleGetPins(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+
+	if !h.checkRoomMember(w, r, roomID, claims.UserID) {
+		return
+	}
+
+	pins, err := h.repo.GetPinnedMessages(r.Context(), roomID)
+	if err != nil {
+		slog.Error("Failed to load pinned messages", "error", err, "roomID", roomID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(pins); err != nil {
+		slog.Error("Failed to write pins response", "error", err)
+	}
+}
+
+// HandleAddModerator is the HTTP handler for the PUT /api/rooms/{roomID}/moderators/{userID}
+// endpoint. Only the owner of a room may appoint moderators.
+func (h *Handler) HandleAddModerator(w http.ResponseWriter, r *http.Request) {
+	h.setModerator(w, r, domain.RoleModerator)
+}
+
+// HandleRemoveModerator is the HTTP handler for the DELETE /api/rooms/{roomID}/moderators/{userID}
+// endpoint. Only the owner of a room may remove moderators.
+func (h *Handler) HandleRemoveModerator(w http.ResponseWriter, r *http.Request) {
+	h.setModerator(w, r, "")
+}
+
+// setModerator changes the role of a user in a room on behalf of the room owner.
+func (h *Handler) setModerator(w http.ResponseWriter, r *http.Request, role string) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	roomID := chi.URLParam(r, "roomID")
+	userID := chi.URLParam(r, "userID")
+
+	callerRole, err := h.repo.GetRoomRole(r.Context(), roomID, claims.UserID)
+	if err != nil {
+		slog.Error("Failed to load room role", "error", err, "roomID", roomID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if callerRole != domain.RoleOwner {
+		http.Error(w, "Only the room owner can manage moderators", http.StatusForbidden)
+		return
+	}
+	if _, err := h.repo.FindUserByID(r.Context(), userID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.repo.SetRoomRole(r.Context(), roomID, userID, role, claims.UserID); err != nil {
+		slog.Error("Failed to set room role", "error", err, "roomID", roomID, "userID", userID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.hub.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditRoleChange,
+		ActorID:    claims.UserID,
+		ActorName:  claims.Username,
+		RoomID:     roomID,
+		TargetID:   userID,
+		RemoteAddr: audit.RemoteAddr(r),
+		Details:    map[string]string{"role": cmp.Or(role, "none")},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateConversationRequest defines the structure of a request to create a group conversation.
+type CreateConversationRequest struct {
+	Name           string   `json:"name"`
+	ParticipantIDs []string `json:"participant_ids"`
+}
+
+// HandleCreateConversation is the HTTP handler for the POST /api/conversations endpoint.
+// The caller is always added to the participants.
+func (h *Handler) HandleCreateConversation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	var req CreateConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	participantIDs := []string{claims.UserID}
+	seen := map[string]bool{claims.UserID: true}
+	for _, id := range req.ParticipantIDs {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			participantIDs = append(participantIDs, id)
+		}
+	}
+	if len(participantIDs) < minGroupParticipants || len(participantIDs) > maxGroupParticipants {
+		http.Error(w, "A group conversation needs between 3 and 50 participants", http.StatusBadRequest)
+		return
+	}
+
+	conv := &domain.Conversation{Name: req.Name, CreatedBy: claims.UserID}
+	if err := h.repo.CreateConversation(r.Context(), conv, participantIDs); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Unknown participant", http.StatusBadRequest)
+			return
+		}
+		slog.Error("Failed to create conversation", "error", err, "userID", claims.UserID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.hub.NotifyUsers(participantIDs, &domain.Message{Type: "conversation_created", Payload: conv, Sender: claims.UserID})
+	h.hub.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditGroupCreated,
+		ActorID:    claims.UserID,
+		ActorName:  claims.Username,
+		TargetID:   conv.ID,
+		RemoteAddr: audit.RemoteAddr(r),
+		Details:    map[string]string{"members": strings.Join(participantIDs, ",")},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(conv); err != nil {
+		slog.Error("Failed to write conversation response", "error", err)
+	}
+}
+
+// HandleGetConversations is the HTTP handler for the GET /api/conversations endpoint.
+// It lists the group conversations the caller participates in.
+func (h *Handler) HandleGetConversations(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+
+	conversations, err := h.repo.GetConversationsForUser(r.Context(), claims.UserID)
+	if err != nil {
+		slog.Error("Failed to load conversations", "error", err, "userID", claims.UserID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if conversations == nil {
+		conversations = []*domain.Conversation{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(conversations); err != nil {
+		slog.Error("Failed to write conversations response", "error", err)
+	}
+}
+
+// HandleGetConversationMessages is the HTTP handler for the
+// GET /api/conversations/{conversationID}/messages endpoint. It returns a page of the
+// conversation's messages, oldest first, and is restricted to its participants.
+func (h *Handler) HandleGetConversationMessages(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	conversationID := chi.URLParam(r, "conversationID")
+
+	limit, ok := historyLimit(r)
+	if !ok {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+	before, ok := historyBefore(r)
+	if !ok {
+		http.Error(w, "Invalid before parameter", http.StatusBadRequest)
+		return
+	}
+
+	memberIDs, err := h.repo.GetConversationMemberIDs(r.Context(), conversationID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		slog.Error("Failed to load conversation members", "error", err, "conversationID", conversationID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !slices.Contains(memberIDs, claims.UserID) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+
+	messages, err := h.repo.GetGroupMessages(r.Context(), conversationID, before, limit)
+	if err != nil {
+		slog.Error("Failed to load group messages", "error", err, "conversationID", conversationID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if messages == nil {
+		messages = []*domain.GroupMessage{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		slog.Error("Failed to write group messages response", "error", err)
+	}
+}
+
+// HandleSearch is the HTTP handler for the GET /api/search endpoint. It returns the
+// chat messages matching the q parameter in the rooms the caller has joined, best
+// matches first, optionally restricted with the room, sender, from and to parameters.
+// Dates are RFC 3339 times or YYYY-MM-DD days, to being exclusive. Further pages are
+// requested with the offset of the previous response.
+func (h *Handler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.ClaimsFromContext(r.Context())
+	params := r.URL.Query()
+
+	q := domain.SearchQuery{
+		UserID:   claims.UserID,
+		Text:     strings.TrimSpace(params.Get("q")),
+		RoomID:   params.Get("room"),
+		SenderID: params.Get("sender"),
+	}
+	if q.Text == "" || utf8.RuneCountInString(q.Text) > maxSearchLength {
+		http.Error(w, "Invalid q parameter", http.StatusBadRequest)
+		return
+	}
+
+	var ok bool
+	if q.From, ok = searchTime(params.Get("from")); !ok {
+		http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+		return
+	}
+	if q.To, ok = searchTime(params.Get("to")); !ok {
+		http.Error(w, "Invalid to parameter", http.StatusBadRequest)
+		return
+	}
+	if q.Limit, ok = historyLimit(r); !ok {
+		http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+		return
+	}
+	if offsetParam := params.Get("offset"); offsetParam != "" {
+		n, err := strconv.Atoi(offsetParam)
+		if err != nil || n < 0 || n > maxSearchOffset {
+			http.Error(w, "Invalid offset parameter", http.StatusBadRequest)
+			return
+		}
+		q.Offset = n
+	}
+
+	hits, err := h.repo.SearchMessages(r.Context(), q)
+	if err != nil {
+		slog.Error("Failed to search messages", "error", err, "userID", claims.UserID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	results := domain.SearchResults{Hits: hits}
+	if results.Hits == nil {
+		results.Hits = []*domain.SearchHit{}
+	}
+	if len(hits) == q.Limit && q.Offset+q.Limit <= maxSearchOffset {
+		results.NextOffset = q.Offset + q.Limit
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		slog.Error("Failed to write search response", "error", err)
+	}
+}
+
+// searchTime parses an optional search date, either an RFC 3339 time or a
+// YYYY-MM-DD day in UTC. It reports false if the value is malformed.
+func searchTime(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// historyLimit reads the optional limit query parameter of the history endpoints,
+// capped at maxHistoryLimit. It reports false if the parameter is malformed.
+func historyLimit(r *http.Request) (int, bool) {
+	limitParam := r.URL.Query().Get("limit")
+	if limitParam == "" {
+		return defaultHistoryLimit, true
+	}
+	n, err := strconv.Atoi(limitParam)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return min(n, maxHistoryLimit), true
+}
+
+// historyBefore reads the optional before query parameter used to page backwards
+// through message history. It reports false if the parameter is malformed.
+func historyBefore(r *http.Request) (int64, bool) {
+	beforeParam := r.URL.Query().Get("before")
+	if beforeParam == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(beforeParam, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
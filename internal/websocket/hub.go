@@ -1,15 +1,19 @@
 package websocket
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"errors"
 	"log/slog"
+	"time"
 
+	"github.com/Lec7ral/WithWebSocket/internal/audit"
 	"github.com/Lec7ral/WithWebSocket/internal/auth"
 	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/filter"
 	"github.com/Lec7ral/WithWebSocket/internal/repository"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
-	"golang.org/x/time/rate"
 )
 
 // registrationRequest bundles all information needed to register a client.
@@ -17,6 +21,88 @@ type registrationRequest struct {
 	claims *auth.Claims
 	conn   *websocket.Conn
 	roomID string
+
+	// remoteAddr is the IP address the client connected from.
+	remoteAddr string
+
+	// release frees the connection slots reserved for the client once it disconnects.
+	release func()
+
+	// protocol and codec are the protocol version and codec chosen during the
+	// handshake. protocol is 0 if the client did not choose one.
+	protocol int
+	codec    string
+
+	// resume is set when the client reconnected and asked for the events after since.
+	resume bool
+	since  int64
+
+	// The fields below are loaded by prepareRegistration before the request reaches
+	// the hub, so that registering the client takes no database round trips. The
+	// board and seq are only used if the room is not loaded yet.
+	board        *domain.WhiteboardState
+	boardVersion uint64
+	seq          int64
+	mutedUntil   time.Time
+	pins         []*domain.PinnedMessage
+	missed       []*domain.Message
+	pendingDMs   []*domain.DirectMessage
+}
+
+// prepareRegistration records the room and the client's membership and loads what
+// registering the client needs from the database. It runs on the connection's
+// handler goroutine rather than in the hub's event loop; failures are logged and
+// leave the defaults in place, as they would during registration.
+func (h *Hub) prepareRegistration(ctx context.Context, req *registrationRequest) {
+	userID := req.claims.UserID
+	if err := h.repo.EnsureRoom(ctx, req.roomID, userID); err != nil {
+		slog.Error("Failed to record room", "error", err, "roomID", req.roomID)
+	}
+	if err := h.repo.AddRoomMember(ctx, req.roomID, userID); err != nil {
+		slog.Error("Failed to record room member", "error", err, "roomID", req.roomID, "clientID", userID)
+	}
+
+	board, version, err := h.boards.load(ctx, req.roomID)
+	if err != nil {
+		slog.Error("Failed to load whiteboard state", "error", err, "roomID", req.roomID)
+		board = &domain.WhiteboardState{Events: []domain.DrawEvent{}}
+	}
+	req.board, req.boardVersion = board, version
+
+	if req.seq, err = h.repo.GetRoomSeq(ctx, req.roomID); err != nil {
+		slog.Error("Failed to load room sequence", "error", err, "roomID", req.roomID)
+	}
+	if req.mutedUntil, err = h.repo.GetMuteExpiry(ctx, req.roomID, userID); err != nil {
+		slog.Error("Failed to load room mute", "error", err, "roomID", req.roomID, "clientID", userID)
+	}
+	if req.pins, err = h.repo.GetPinnedMessages(ctx, req.roomID); err != nil {
+		slog.Error("Failed to load pinned messages", "error", err, "roomID", req.roomID)
+		req.pins = []*domain.PinnedMessage{}
+	}
+	if req.resume {
+		if req.missed, err = h.repo.GetMessagesSince(ctx, req.roomID, req.since, replayHistoryLimit); err != nil {
+			slog.Error("Failed to load missed messages", "error", err, "roomID", req.roomID)
+		}
+	}
+	if req.pendingDMs, err = h.repo.GetPendingDirectMessages(ctx, userID, pendingDirectMessageLimit); err != nil {
+		slog.Error("Failed to load pending direct messages", "error", err, "clientID", userID)
+	}
+}
+
+// inboundMessage is a message read from a client, paired with the client that sent it.
+type inboundMessage struct {
+	client *Client
+	msg    *domain.Message
+
+	// rejection is set when the client refused the message while decoding it. The hub
+	// only sends it back to the client as an error.
+	rejection *domain.ErrorPayload
+}
+
+// userNotification is a message to deliver to every connection of a set of users.
+type userNotification struct {
+	userIDs []string
+	msg     *domain.Message
 }
 
 // RoomInfo is a simple structure for returning public information about a room.
@@ -27,41 +113,63 @@ type RoomInfo struct {
 
 type Hub struct {
 	repo             repository.Repository
+	filters          filter.Chain
+	auditLog         *audit.Logger
+	rates            MessageRates
 	rooms            map[string]map[*Client]bool
-	clients          map[string]*Client
+	clients          map[string]map[*Client]bool
 	whiteboardStates map[string]*domain.WhiteboardState
-	broadcast        chan *domain.Message
+	boards           *boardSaver
+	dirtyBoards      map[string]bool
+	sequences        map[string]int64
+	reservedSeqs     map[string]int64
+	replays          map[string]*replayBuffer
+	broadcast        chan *inboundMessage
 	register         chan *registrationRequest
 	unregister       chan *Client
-	getRooms         chan chan []RoomInfo
+	commands         chan func()
+	notifications    chan *userNotification
 }
 
-func NewHub(repo repository.Repository) *Hub {
+func NewHub(repo repository.Repository, filters filter.Chain, auditLog *audit.Logger, rates MessageRates) *Hub {
 	return &Hub{
 		repo:             repo,
-		broadcast:        make(chan *domain.Message, 256),
+		filters:          filters,
+		auditLog:         auditLog,
+		rates:            rates,
+		broadcast:        make(chan *inboundMessage, 256),
 		register:         make(chan *registrationRequest),
 		unregister:       make(chan *Client),
 		rooms:            make(map[string]map[*Client]bool),
-		clients:          make(map[string]*Client),
+		clients:          make(map[string]map[*Client]bool),
 		whiteboardStates: make(map[string]*domain.WhiteboardState),
-		getRooms:         make(chan chan []RoomInfo),
+		boards:           newBoardSaver(repo),
+		dirtyBoards:      make(map[string]bool),
+		sequences:        make(map[string]int64),
+		reservedSeqs:     make(map[string]int64),
+		replays:          make(map[string]*replayBuffer),
+		commands:         make(chan func()),
+		notifications:    make(chan *userNotification, 64),
 	}
 }
 
 func (h *Hub) Run() {
+	go h.boards.run()
+	saveBoards := time.NewTicker(boardSaveInterval)
+	defer saveBoards.Stop()
+
 	for {
 		select {
 		case req := <-h.register:
 			// If this is the first client, load the whiteboard state.
 			if _, ok := h.rooms[req.roomID]; !ok {
 				h.rooms[req.roomID] = make(map[*Client]bool)
-				state, err := h.repo.GetWhiteboardState(context.Background(), req.roomID)
-				if err != nil {
-					h.whiteboardStates[req.roomID] = &domain.WhiteboardState{Events: []domain.DrawEvent{}}
-				} else {
-					h.whiteboardStates[req.roomID] = state
+				h.whiteboardStates[req.roomID] = h.registrationBoard(req)
+				if _, ok := h.sequences[req.roomID]; !ok {
+					h.sequences[req.roomID] = req.seq
+					h.reservedSeqs[req.roomID] = req.seq
 				}
+				h.replays[req.roomID] = newReplayBuffer(h.currentSeq(req.roomID))
 			}
 
 			existingUsers := make([]*domain.User, 0, len(h.rooms[req.roomID]))
@@ -70,132 +178,575 @@ func (h *Hub) Run() {
 			}
 
 			client := &Client{
-				hub:      h,
-				ID:       req.claims.UserID,
-				Username: req.claims.Username,
-				RoomID:   req.roomID,
-				conn:     req.conn,
-				send:     make(chan []byte, 256),
-				limiter:  rate.NewLimiter(5, 10),
+				hub:         h,
+				ID:          req.claims.UserID,
+				Username:    req.claims.Username,
+				RoomID:      req.roomID,
+				RemoteAddr:  req.remoteAddr,
+				ConnID:      uuid.NewString(),
+				ConnectedAt: time.Now(),
+				conn:        req.conn,
+				send:        make(chan frame, 256),
+				limiters:    h.rates.newLimiters(),
+				release:     req.release,
+				protocol:    cmp.Or(req.protocol, protocolV1),
+				codec:       cmp.Or(req.codec, codecJSON),
+				negotiated:  req.protocol != 0,
+			}
+
+			if req.claims.ExpiresAt != nil {
+				client.expiresAt = req.claims.ExpiresAt.Time
 			}
 
+			client.setMutedUntil(req.mutedUntil)
+
 			h.rooms[client.RoomID][client] = true
-			h.clients[client.ID] = client
+			if h.clients[client.ID] == nil {
+				h.clients[client.ID] = make(map[*Client]bool)
+			}
+			h.clients[client.ID][client] = true
 			slog.Info("Client registered", "clientID", client.ID, "username", client.Username, "roomID", client.RoomID)
+			h.auditLog.Record(domain.AuditEvent{
+				Type:       domain.AuditRoomJoin,
+				ActorID:    client.ID,
+				ActorName:  client.Username,
+				RoomID:     client.RoomID,
+				RemoteAddr: client.RemoteAddr,
+			})
 
-			initialState := &domain.RoomState{Users: existingUsers, Whiteboard: h.whiteboardStates[client.RoomID]}
-			initialStateMsg := &domain.Message{Type: "initial_state", Payload: initialState}
-			jsonInitialState, _ := json.Marshal(initialStateMsg)
-			client.send <- jsonInitialState
+			if client.negotiated {
+				h.sendToClient(client, h.welcomeMessage(client))
+			}
+			h.sendToClient(client, h.joinMessage(client, existingUsers, req))
+			h.deliverPendingDirectMessages(client, req.pendingDMs)
 
 			allUsersInRoom := append(existingUsers, &domain.User{ID: client.ID, UserName: client.Username})
-			updateMsg := &domain.Message{Type: "user_list_update", Payload: allUsersInRoom}
-			jsonUpdateMsg, _ := json.Marshal(updateMsg)
-			for c := range h.rooms[client.RoomID] {
-				if c.ID != client.ID {
-					c.send <- jsonUpdateMsg
-				}
-			}
+			h.sendPresence(client, "user_joined", allUsersInRoom)
 
 			go client.writePump()
 			go client.readPump()
 
 		case client := <-h.unregister:
-			if room, ok := h.rooms[client.RoomID]; ok {
-				if _, clientExists := room[client]; clientExists {
-					delete(room, client)
-					delete(h.clients, client.ID)
-					close(client.send)
-					slog.Info("Client unregistered", "clientID", client.ID, "roomID", client.RoomID)
-
-					if len(room) == 0 {
-						delete(h.rooms, client.RoomID)
-						delete(h.whiteboardStates, client.RoomID)
-						slog.Info("Room deleted", "roomID", client.RoomID)
-						continue
-					}
-
-					remainingUsers := make([]*domain.User, 0, len(room))
-					for c := range room {
-						remainingUsers = append(remainingUsers, &domain.User{ID: c.ID, UserName: c.Username})
-					}
-					updateMsg := &domain.Message{Type: "user_list_update", Payload: remainingUsers}
-					jsonUpdateMsg, _ := json.Marshal(updateMsg)
-					for c := range room {
-						c.send <- jsonUpdateMsg
-					}
-				}
+			h.removeClient(client)
+
+		case in := <-h.broadcast:
+			message := in.msg
+			if _, ok := h.rooms[in.client.RoomID][in.client]; !ok {
+				// The client was disconnected by the hub, for example when it was kicked.
+				continue
+			}
+			if in.rejection != nil {
+				h.sendToClient(in.client, &domain.Message{Type: "error", Payload: in.rejection})
+				continue
 			}
 
-		case message := <-h.broadcast:
 			// --- Whiteboard state persistence ---
-			isDrawEvent := message.Type == "draw_start" || message.Type == "draw_move" || message.Type == "draw_end"
+			isDrawEvent := isDrawType(message.Type)
 			isClearEvent := message.Type == "clear_board"
 			if isDrawEvent || isClearEvent {
 				// ... (whiteboard persistence logic)
 			}
+			if isClearEvent {
+				h.auditLog.Record(domain.AuditEvent{
+					Type:       domain.AuditClearBoard,
+					ActorID:    in.client.ID,
+					ActorName:  in.client.Username,
+					RoomID:     message.RoomID,
+					RemoteAddr: in.client.RemoteAddr,
+				})
+				// Clearing the board also removes the images placed on it.
+				if state, ok := h.whiteboardStates[message.RoomID]; ok && len(state.Images) > 0 {
+					state.Images = nil
+					h.saveWhiteboardState(message.RoomID)
+				}
+			}
+			if message.Type == "image_add" || message.Type == "image_update" || message.Type == "image_remove" {
+				h.handleWhiteboardImage(in.client, message)
+				continue
+			}
 
 			// --- Message persistence ---
-			if message.Type == "text_message" {
-				if err := h.repo.SaveMessage(context.Background(), message); err != nil {
-					slog.Error("Failed to save message", "error", err)
+			if message.Type == "text_message" || message.Type == "attachment" {
+				// Retries are acknowledged before filtering, so that they are not
+				// taken for spam.
+				if h.acknowledgeRetry(in.client, message) {
+					continue
+				}
+				if message.Type == "attachment" && !h.resolveAttachment(in.client, message) {
+					continue
+				}
+				flags, ok := h.filterMessage(in.client, message)
+				if !ok {
+					continue
 				}
+				if h.persistChatMessage(in.client, message) {
+					h.flagMessage(in.client, message, flags)
+					h.resolveMentions(message)
+					h.broadcastToRoom(message)
+					h.broadcastThreadUpdate(message)
+					h.notifyMentions(message)
+				}
+				continue
 			}
 
 			// --- Message Routing ---
 			if message.Type == "direct_message" {
-				if payload, ok := message.Payload.(domain.DirectMessagePayload); ok {
-					if recipient, ok := h.clients[payload.RecipientID]; ok {
-						dm := &domain.Message{Type: "direct_message", Sender: message.Sender, Payload: payload.Content}
-						jsonDM, _ := json.Marshal(dm)
-						select {
-						case recipient.send <- jsonDM:
-						default:
-							slog.Warn("Failed to send DM, recipient channel full", "recipientID", payload.RecipientID)
-						}
-					}
-				}
+				h.routeDirectMessage(in.client, message)
+				continue
+			}
+			if message.Type == "hello" {
+				h.handleHello(in.client, message)
+				continue
+			}
+			if message.Type == "dm_read" {
+				h.handleDirectMessageRead(in.client, message)
+				continue
+			}
+			if message.Type == "group_message" {
+				h.routeGroupMessage(in.client, message)
+				continue
+			}
+			if message.Type == "edit_message" {
+				h.handleEditMessage(in.client, message)
+				continue
+			}
+			if message.Type == "delete_message" {
+				h.handleDeleteMessage(in.client, message)
+				continue
+			}
+			if isModerationCommand(message.Type) {
+				h.handleModeration(in.client, message)
+				continue
+			}
+			if message.Type == "pin_message" || message.Type == "unpin_message" {
+				h.handlePin(in.client, message)
+				continue
+			}
+			if message.Type == "add_reaction" || message.Type == "remove_reaction" {
+				h.handleReaction(in.client, message)
 				continue
 			}
 
 			// --- Room Broadcast Logic ---
-			if room, ok := h.rooms[message.RoomID]; ok {
-				messageToSend, err := json.Marshal(message)
-				if err != nil {
-					slog.Error("Failed to marshal broadcast message", "error", err)
-					continue
-				}
+			h.broadcastToRoom(message)
 
-				for cl := range room {
-					isEphemeralEvent := message.Type == "draw_start" || message.Type == "draw_move" || message.Type == "draw_end" || message.Type == "clear_board" || message.Type == "typing_start" || message.Type == "typing_stop"
-					if isEphemeralEvent && cl.ID == message.Sender {
-						continue
-					}
-
-					select {
-					case cl.send <- messageToSend:
-					default:
-						close(cl.send)
-						delete(room, cl)
-					}
-				}
-			}
+		case n := <-h.notifications:
+			h.notifyUsers(n.userIDs, n.msg)
 
-		case responseChan := <-h.getRooms:
-			rooms := make([]RoomInfo, 0, len(h.rooms))
-			for roomID, clients := range h.rooms {
-				if len(clients) > 0 {
-					rooms = append(rooms, RoomInfo{ID: roomID, ClientCount: len(clients)})
-				}
-			}
-			responseChan <- rooms
+		case cmd := <-h.commands:
+			cmd()
+
+		case <-saveBoards.C:
+			h.saveChangedBoards()
+		}
+	}
+}
+
+// removeClient unregisters a client, closing its send channel, and tells the rest
+// of its room who is left. Rooms are deleted once their last client leaves.
+func (h *Hub) removeClient(client *Client) {
+	room, ok := h.rooms[client.RoomID]
+	if !ok {
+		return
+	}
+	if _, clientExists := room[client]; !clientExists {
+		return
+	}
+	delete(room, client)
+	h.forgetClient(client)
+	close(client.send)
+	slog.Info("Client unregistered", "clientID", client.ID, "roomID", client.RoomID)
+	h.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditRoomLeave,
+		ActorID:    client.ID,
+		ActorName:  client.Username,
+		RoomID:     client.RoomID,
+		RemoteAddr: client.RemoteAddr,
+	})
+
+	if len(room) == 0 {
+		if h.dirtyBoards[client.RoomID] {
+			h.saveWhiteboardState(client.RoomID)
+		}
+		delete(h.rooms, client.RoomID)
+		delete(h.whiteboardStates, client.RoomID)
+		delete(h.replays, client.RoomID)
+		slog.Info("Room deleted", "roomID", client.RoomID)
+		return
+	}
+
+	remainingUsers := make([]*domain.User, 0, len(room))
+	for c := range room {
+		remainingUsers = append(remainingUsers, &domain.User{ID: c.ID, UserName: c.Username})
+	}
+	h.sendPresence(client, "user_left", remainingUsers)
+}
+
+// sendPresence tells the rest of a room that a client joined or left it. Clients of
+// protocol version 1 get the full `user_list_update`; later versions get a
+// `user_joined` or `user_left` delta, only when the user's first connection to the
+// room joined or its last one left.
+func (h *Hub) sendPresence(client *Client, deltaType string, users []*domain.User) {
+	list := newMessageEncoder(&domain.Message{Type: "user_list_update", Payload: users})
+	delta := newMessageEncoder(&domain.Message{
+		Type:    deltaType,
+		Payload: &domain.User{ID: client.ID, UserName: client.Username},
+		RoomID:  client.RoomID,
+	})
+	userStillPresent := false
+	for c := range h.rooms[client.RoomID] {
+		if c.ID == client.ID && c != client {
+			userStillPresent = true
+		}
+	}
+	for c := range h.rooms[client.RoomID] {
+		if c == client {
+			continue
+		}
+		if f, ok := list.frame(c); ok {
+			h.queue(c, f)
+		}
+		if userStillPresent || c.ID == client.ID {
+			continue
+		}
+		if f, ok := delta.frame(c); ok {
+			h.queue(c, f)
 		}
 	}
 }
 
 // GetActiveRooms is a thread-safe method to get the list of active rooms.
 func (h *Hub) GetActiveRooms() []RoomInfo {
-	responseChan := make(chan []RoomInfo)
-	h.getRooms <- responseChan
-	return <-responseChan
+	var rooms []RoomInfo
+	h.do(func() {
+		rooms = make([]RoomInfo, 0, len(h.rooms))
+		for roomID, clients := range h.rooms {
+			if len(clients) > 0 {
+				rooms = append(rooms, RoomInfo{ID: roomID, ClientCount: len(clients)})
+			}
+		}
+	})
+	return rooms
+}
+
+// broadcastToRoom sends a message to every client of its room, except for transient
+// events which are not echoed back to their sender. Replayable events are given the
+// next sequence number of the room, unless they already have one, and kept in the
+// room's replay buffer.
+func (h *Hub) broadcastToRoom(message *domain.Message) {
+	room, ok := h.rooms[message.RoomID]
+	if !ok {
+		return
+	}
+	if isReplayable(message.Type) && message.Seq == 0 {
+		message.Seq = h.nextSeq(message.RoomID)
+	}
+
+	enc := newMessageEncoder(message)
+	isEphemeralEvent := isDrawType(message.Type) || message.Type == "clear_board" || message.Type == "typing_start" || message.Type == "typing_stop"
+	if message.Seq > 0 {
+		if buf, ok := h.replays[message.RoomID]; ok {
+			buf.add(sequencedEvent{seq: message.Seq, msg: message, sender: message.Sender, echoed: !isEphemeralEvent})
+		}
+	}
+
+	for cl := range room {
+		if isEphemeralEvent && cl.ID == message.Sender {
+			continue
+		}
+
+		f, ok := enc.frame(cl)
+		if !ok {
+			continue
+		}
+		select {
+		case cl.send <- f:
+		default:
+			close(cl.send)
+			delete(room, cl)
+			h.forgetClient(cl)
+		}
+	}
+}
+
+// isModerator reports whether a user may moderate a room.
+func (h *Hub) isModerator(roomID, userID string) bool {
+	role, err := h.repo.GetRoomRole(context.Background(), roomID, userID)
+	if err != nil {
+		slog.Error("Failed to load room role", "error", err, "roomID", roomID, "userID", userID)
+		return false
+	}
+	return role == domain.RoleOwner || role == domain.RoleModerator
+}
+
+// joinMessage builds the first message sent to a newly registered client: a resume
+// carrying the missed events when it reconnected from a sequence number that can
+// still be replayed from memory, or the full initial state otherwise. In the latter
+// case the chat messages it missed come from the database, completed with the ones
+// broadcast since they were loaded.
+func (h *Hub) joinMessage(client *Client, users []*domain.User, req *registrationRequest) *domain.Message {
+	seq := h.currentSeq(client.RoomID)
+	canResume := req.resume && req.since <= seq
+	if canResume {
+		if events, ok := h.replays[client.RoomID].since(req.since, client.ID); ok {
+			slog.Debug("Client resumed", "clientID", client.ID, "roomID", client.RoomID, "since", req.since, "events", len(events))
+			return &domain.Message{
+				Type:    "resume",
+				Payload: &domain.RoomResume{Users: users, Seq: seq, Events: events},
+				RoomID:  client.RoomID,
+			}
+		}
+	}
+
+	state := &domain.RoomState{Users: users, Whiteboard: h.whiteboardStates[client.RoomID], Seq: seq, Pins: req.pins}
+	if canResume {
+		state.Messages = h.missedMessages(client, req)
+	}
+	return &domain.Message{Type: "initial_state", Payload: state}
+}
+
+// registrationBoard returns the board loaded with a registration request, or loads
+// it again if a newer snapshot was scheduled in the meantime, which only happens
+// when the room was closed while the client was connecting.
+func (h *Hub) registrationBoard(req *registrationRequest) *domain.WhiteboardState {
+	if req.board != nil && req.boardVersion == h.boards.version(req.roomID) {
+		return req.board
+	}
+	state, _, err := h.boards.load(context.Background(), req.roomID)
+	if err != nil {
+		slog.Error("Failed to load whiteboard state", "error", err, "roomID", req.roomID)
+		return &domain.WhiteboardState{Events: []domain.DrawEvent{}}
+	}
+	return state
+}
+
+// missedMessages returns the chat messages loaded with a registration request,
+// followed by those saved after they were loaded and still in the replay buffer.
+// Messages are saved in sequence order by the hub, so the loaded ones are all the
+// messages up to the last of them.
+func (h *Hub) missedMessages(client *Client, req *registrationRequest) []*domain.Message {
+	if len(req.missed) >= replayHistoryLimit {
+		return req.missed
+	}
+	last := req.since
+	if len(req.missed) > 0 {
+		last = req.missed[len(req.missed)-1].Seq
+	}
+	events, ok := h.replays[client.RoomID].since(last, "")
+	if !ok {
+		return req.missed
+	}
+	missed := req.missed
+	for _, ev := range events {
+		if (ev.Type == "text_message" || ev.Type == "attachment") && len(missed) < replayHistoryLimit {
+			missed = append(missed, ev)
+		}
+	}
+	return missed
+}
+
+// currentSeq returns the latest sequence number of a room, loading it from the
+// database the first time the room is seen. Counters outlive the rooms themselves
+// so that sequence numbers keep increasing when a room empties and is reopened.
+func (h *Hub) currentSeq(roomID string) int64 {
+	seq, ok := h.sequences[roomID]
+	if !ok {
+		var err error
+		seq, err = h.repo.GetRoomSeq(context.Background(), roomID)
+		if err != nil {
+			slog.Error("Failed to load room sequence", "error", err, "roomID", roomID)
+		}
+		h.sequences[roomID] = seq
+		h.reservedSeqs[roomID] = seq
+	}
+	return seq
+}
+
+// seqBlockSize is how many sequence numbers are reserved in the database at a time.
+// Numbers reserved by a previous run but never used are skipped, so that the numbers
+// clients hold are never reused; the gap is harmless since the replay buffer of a
+// reloaded room starts after it.
+const seqBlockSize = 1000
+
+// nextSeq allocates the next sequence number of a room, reserving a new block of
+// numbers in the database when the reserved ones run out.
+func (h *Hub) nextSeq(roomID string) int64 {
+	seq := h.currentSeq(roomID) + 1
+	if seq > h.reservedSeqs[roomID] {
+		reserved, err := h.repo.ReserveRoomSeqs(context.Background(), roomID, seqBlockSize)
+		if err != nil {
+			slog.Error("Failed to reserve room sequence numbers", "error", err, "roomID", roomID)
+		} else {
+			h.reservedSeqs[roomID] = reserved
+		}
+	}
+	h.sequences[roomID] = seq
+	return seq
+}
+
+// releaseSeq gives back the sequence number just allocated to an event that was not
+// broadcast after all, so that clients do not take the gap for a missed event.
+func (h *Hub) releaseSeq(roomID string, seq int64) {
+	if h.sequences[roomID] == seq {
+		h.sequences[roomID] = seq - 1
+	}
+}
+
+// persistChatMessage saves a chat message and acknowledges it to its sender.
+// It reports whether the message should be broadcast to the room; duplicates of an
+// already accepted message and messages that could not be stored are not broadcast.
+func (h *Hub) persistChatMessage(sender *Client, message *domain.Message) bool {
+	if message.ParentID != 0 {
+		parent, err := h.repo.GetMessageByID(context.Background(), message.ParentID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Failed to load parent message", "error", err, "parentID", message.ParentID)
+		}
+		if err != nil || parent.RoomID != message.RoomID || parent.Deleted {
+			h.sendError(sender, message.ClientMsgID, domain.ErrorNotFound, "parent message not found")
+			return false
+		}
+		// Threads are a single level deep: replies to a reply join the root's thread.
+		if parent.ParentID != 0 {
+			message.ParentID = parent.ParentID
+		}
+	}
+
+	// The sequence number is stored with the message, so it is allocated before the
+	// insert and given back if the insert does not happen. Nothing else can take a
+	// number in between, since only the hub allocates them.
+	message.Seq = h.nextSeq(message.RoomID)
+	err := h.repo.SaveMessage(context.Background(), message)
+	if err != nil {
+		h.releaseSeq(message.RoomID, message.Seq)
+	}
+	if errors.Is(err, repository.ErrDuplicateMessage) {
+		slog.Debug("Duplicate message acknowledged", "clientID", message.Sender, "clientMsgID", message.ClientMsgID)
+		h.sendAck(sender, message.ClientMsgID, message.ID, message.Timestamp, true)
+		return false
+	}
+	if err != nil {
+		slog.Error("Failed to save message", "error", err)
+		h.sendError(sender, message.ClientMsgID, domain.ErrorInternal, "message could not be saved")
+		return false
+	}
+	h.sendAck(sender, message.ClientMsgID, message.ID, message.Timestamp, false)
+	return true
+}
+
+// acknowledgeRetry acknowledges a chat message as a duplicate if its sender already
+// submitted a message with the same client message ID, such as when resending it
+// after reconnecting. It reports whether the message was a retry.
+func (h *Hub) acknowledgeRetry(sender *Client, message *domain.Message) bool {
+	if message.ClientMsgID == "" {
+		return false
+	}
+	id, timestamp, err := h.repo.GetMessageIDByClientMsgID(context.Background(), sender.ID, message.ClientMsgID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Failed to look up client message", "error", err, "clientMsgID", message.ClientMsgID)
+		}
+		return false
+	}
+	slog.Debug("Duplicate message acknowledged", "clientID", sender.ID, "clientMsgID", message.ClientMsgID)
+	h.sendAck(sender, message.ClientMsgID, id, timestamp, true)
+	return true
+}
+
+// broadcastThreadUpdate tells the room that the thread a reply belongs to changed,
+// with the updated reply count of its parent.
+func (h *Hub) broadcastThreadUpdate(reply *domain.Message) {
+	if reply.ParentID == 0 {
+		return
+	}
+	parent, err := h.repo.GetMessageByID(context.Background(), reply.ParentID)
+	if err != nil {
+		slog.Error("Failed to load parent message", "error", err, "parentID", reply.ParentID)
+		return
+	}
+	h.broadcastToRoom(&domain.Message{
+		Type: "thread_updated",
+		Payload: domain.ThreadUpdatedPayload{
+			MessageID:   parent.ID,
+			ReplyCount:  parent.ReplyCount,
+			LastReplyAt: reply.Timestamp,
+		},
+		RoomID: reply.RoomID,
+	})
+}
+
+// sendAck confirms to a client that the message it tagged with clientMsgID was
+// accepted and stored under messageID.
+func (h *Hub) sendAck(c *Client, clientMsgID string, messageID int64, timestamp time.Time, duplicate bool) {
+	h.sendToClient(c, &domain.Message{
+		Type: "ack",
+		Payload: domain.AckPayload{
+			ClientMsgID: clientMsgID,
+			MessageID:   messageID,
+			Timestamp:   timestamp,
+			Duplicate:   duplicate,
+		},
+	})
+}
+
+// sendError tells a client that one of its messages was rejected, with one of the
+// domain.Error* codes and a human readable reason.
+func (h *Hub) sendError(c *Client, clientMsgID, code, reason string) {
+	h.sendToClient(c, &domain.Message{
+		Type:    "error",
+		Payload: domain.ErrorPayload{ClientMsgID: clientMsgID, Code: code, Message: reason},
+	})
+}
+
+// sendToClient queues a message for a single client without blocking the hub and
+// reports whether it was queued. Clients that have already been unregistered are
+// skipped, since their send channel is closed.
+func (h *Hub) sendToClient(c *Client, msg *domain.Message) bool {
+	if c == nil {
+		return false
+	}
+	if _, ok := h.rooms[c.RoomID][c]; !ok {
+		return false
+	}
+	f, ok := newMessageEncoder(msg).frame(c)
+	if !ok {
+		return false
+	}
+	return h.queue(c, f)
+}
+
+// queue queues an encoded message for a client without blocking the hub and reports
+// whether it was queued. The client must still be registered.
+func (h *Hub) queue(c *Client, f frame) bool {
+	select {
+	case c.send <- f:
+		return true
+	default:
+		slog.Warn("Failed to send message, client channel full", "clientID", c.ID)
+		return false
+	}
+}
+
+// notifyUsers queues a message for every connection of the given users, in any room.
+func (h *Hub) notifyUsers(userIDs []string, msg *domain.Message) {
+	for _, id := range userIDs {
+		for c := range h.clients[id] {
+			h.sendToClient(c, msg)
+		}
+	}
+}
+
+// NotifyUsers is a thread-safe method to deliver a message to every connection of
+// the given users from outside the hub, such as from the REST API.
+func (h *Hub) NotifyUsers(userIDs []string, msg *domain.Message) {
+	h.notifications <- &userNotification{userIDs: userIDs, msg: msg}
+}
+
+// forgetClient removes a connection from the per-user connection index.
+func (h *Hub) forgetClient(c *Client) {
+	if conns, ok := h.clients[c.ID]; ok {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(h.clients, c.ID)
+		}
+	}
 }
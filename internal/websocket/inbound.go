@@ -0,0 +1,281 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/richtext"
+)
+
+// Bounds of the drawing events accepted from clients.
+const (
+	maxDrawCoordinate = 16384
+	maxLineWidth      = 50
+)
+
+// maxIDLength bounds the length of the string identifiers sent by clients.
+const maxIDLength = 64
+
+// drawColorPattern matches the CSS hex colors accepted for strokes.
+var drawColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// inboundFrame is the envelope of every message a client sends. Its payload is
+// decoded once, into the payload type of the message type.
+type inboundFrame struct {
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	ClientMsgID string          `json:"client_msg_id"`
+	ParentID    int64           `json:"parent_id"`
+}
+
+// inboundType describes a message type clients may send.
+type inboundType struct {
+	// decode decodes and validates the raw payload into msg.Payload. It may also set
+	// other fields of msg, such as the rendered HTML of chat messages.
+	decode func(msg *domain.Message, raw json.RawMessage) error
+
+	// room is set for the messages addressed to the client's room.
+	room bool
+}
+
+// inboundTypes lists every message type clients may send.
+var inboundTypes = map[string]inboundType{
+	"hello":           {decode: payload(validateHello)},
+	"text_message":    {decode: payload(validateTextMessage), room: true},
+	"attachment":      {decode: payload(validateAttachment), room: true},
+	"direct_message":  {decode: payload(validateDirectMessage)},
+	"dm_read":         {decode: payload(validateDirectMessageRead)},
+	"group_message":   {decode: payload(validateGroupMessage)},
+	"edit_message":    {decode: payload(validateMessageEdit), room: true},
+	"delete_message":  {decode: payload(validateMessageEdit), room: true},
+	"kick_user":       {decode: payload(validateModeration), room: true},
+	"mute_user":       {decode: payload(validateModeration), room: true},
+	"unmute_user":     {decode: payload(validateModeration), room: true},
+	"ban_user":        {decode: payload(validateModeration), room: true},
+	"unban_user":      {decode: payload(validateModeration), room: true},
+	"pin_message":     {decode: payload(validatePin), room: true},
+	"unpin_message":   {decode: payload(validatePin), room: true},
+	"add_reaction":    {decode: payload(validateReaction), room: true},
+	"remove_reaction": {decode: payload(validateReaction), room: true},
+	"image_add":       {decode: payload(validateWhiteboardImage), room: true},
+	"image_update":    {decode: payload(validateWhiteboardImage), room: true},
+	"image_remove":    {decode: payload(validateWhiteboardImage), room: true},
+	"draw_start":      {decode: payload(validateDrawEvent), room: true},
+	"draw_move":       {decode: payload(validateDrawEvent), room: true},
+	"draw_end":        {decode: noPayload, room: true},
+	"clear_board":     {decode: noPayload, room: true},
+	"typing_start":    {decode: noPayload, room: true},
+	"typing_stop":     {decode: noPayload, room: true},
+}
+
+// payloadError rejects an inbound message with one of the domain.Error* codes.
+type payloadError struct {
+	code   string
+	reason string
+}
+
+func (e *payloadError) Error() string {
+	return e.reason
+}
+
+// invalidPayload returns an invalid_payload error with the given reason.
+func invalidPayload(reason string) error {
+	return &payloadError{code: domain.ErrorInvalidPayload, reason: reason}
+}
+
+// errorCode returns the code of the error that rejected an inbound message.
+func errorCode(err error) string {
+	var pe *payloadError
+	switch {
+	case errors.As(err, &pe):
+		return pe.code
+	case errors.Is(err, richtext.ErrTooLong):
+		return domain.ErrorTooLarge
+	}
+	return domain.ErrorInvalidPayload
+}
+
+// decodeFrame strictly decodes a JSON value: unknown fields and trailing data are
+// rejected.
+func decodeFrame(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON value")
+	}
+	return nil
+}
+
+// payload returns the decode function of a message type whose payload is a T, which
+// validate checks and may normalize.
+func payload[T any](validate func(msg *domain.Message, p *T) error) func(*domain.Message, json.RawMessage) error {
+	return func(msg *domain.Message, raw json.RawMessage) error {
+		var p T
+		if len(raw) == 0 {
+			return invalidPayload(msg.Type + " requires a payload")
+		}
+		if err := decodeFrame(raw, &p); err != nil {
+			return invalidPayload("invalid " + msg.Type + " payload: " + err.Error())
+		}
+		if err := validate(msg, &p); err != nil {
+			return err
+		}
+		msg.Payload = p
+		return nil
+	}
+}
+
+// noPayload is the decode function of the message types without a payload.
+func noPayload(msg *domain.Message, raw json.RawMessage) error {
+	if len(raw) != 0 && string(raw) != "null" {
+		return invalidPayload(msg.Type + " does not take a payload")
+	}
+	msg.Payload = nil
+	return nil
+}
+
+// parseContent renders the Markdown content of a chat message into msg.HTML and
+// replaces the content with its normalized source.
+func parseContent(msg *domain.Message, content *string) error {
+	parsed, err := richtext.Parse(*content)
+	if err != nil {
+		return err
+	}
+	*content = parsed.Source
+	msg.HTML = parsed.HTML
+	return nil
+}
+
+// validID reports whether id is a plausible identifier.
+func validID(id string) bool {
+	return id != "" && len(id) <= maxIDLength
+}
+
+func validateHello(_ *domain.Message, p *domain.HelloPayload) error {
+	if len(p.Versions) == 0 || len(p.Versions) > 16 {
+		return invalidPayload("versions must list the supported protocol versions")
+	}
+	return nil
+}
+
+func validateTextMessage(msg *domain.Message, text *string) error {
+	return parseContent(msg, text)
+}
+
+func validateAttachment(msg *domain.Message, p *domain.AttachmentPayload) error {
+	if !validID(p.AttachmentID) {
+		return invalidPayload("attachment_id is required")
+	}
+	if p.Caption == "" {
+		return nil
+	}
+	return parseContent(msg, &p.Caption)
+}
+
+func validateDirectMessage(_ *domain.Message, p *domain.DirectMessagePayload) error {
+	if !validID(p.RecipientID) {
+		return invalidPayload("recipient_id is required")
+	}
+	content, err := richtext.Parse(p.Content)
+	if err != nil {
+		return err
+	}
+	p.Content = content.Source
+	return nil
+}
+
+func validateDirectMessageRead(_ *domain.Message, p *domain.DirectMessageReadPayload) error {
+	if !validID(p.PeerID) || p.LastReadID <= 0 {
+		return invalidPayload("peer_id and last_read_id are required")
+	}
+	return nil
+}
+
+func validateGroupMessage(_ *domain.Message, p *domain.GroupMessagePayload) error {
+	if !validID(p.ConversationID) {
+		return invalidPayload("conversation_id is required")
+	}
+	content, err := richtext.Parse(p.Content)
+	if err != nil {
+		return err
+	}
+	p.Content = content.Source
+	return nil
+}
+
+func validateMessageEdit(msg *domain.Message, p *domain.MessageEditPayload) error {
+	if p.MessageID <= 0 {
+		return invalidPayload("message_id is required")
+	}
+	if msg.Type == "delete_message" {
+		p.Content = ""
+		return nil
+	}
+	return parseContent(msg, &p.Content)
+}
+
+func validateModeration(_ *domain.Message, p *domain.ModerationPayload) error {
+	if !validID(p.UserID) {
+		return invalidPayload("user_id is required")
+	}
+	if p.DurationSeconds < 0 {
+		return invalidPayload("invalid duration_seconds")
+	}
+	return nil
+}
+
+func validatePin(_ *domain.Message, p *domain.PinPayload) error {
+	if p.MessageID <= 0 {
+		return invalidPayload("message_id is required")
+	}
+	return nil
+}
+
+func validateReaction(_ *domain.Message, p *domain.ReactionPayload) error {
+	if p.MessageID <= 0 {
+		return invalidPayload("message_id is required")
+	}
+	if p.Emoji == "" || len(p.Emoji) > maxEmojiLength {
+		return invalidPayload("invalid emoji")
+	}
+	return nil
+}
+
+func validateWhiteboardImage(msg *domain.Message, p *domain.WhiteboardImage) error {
+	// The URL and the author of an image are assigned by the server.
+	p.URL, p.AddedBy = "", ""
+	if msg.Type == "image_add" {
+		if !validID(p.AttachmentID) {
+			return invalidPayload("attachment_id is required")
+		}
+		return nil
+	}
+	if !validID(p.ID) {
+		return invalidPayload("id is required")
+	}
+	return nil
+}
+
+func validateDrawEvent(_ *domain.Message, p *domain.DrawEventPayload) error {
+	for _, v := range []float64{p.X, p.Y} {
+		if math.Abs(v) > maxDrawCoordinate {
+			return invalidPayload("coordinates are out of range")
+		}
+	}
+	if p.Color != "" && !drawColorPattern.MatchString(p.Color) {
+		return invalidPayload("color must be a hex color such as #2f8f5b")
+	}
+	// A zero lineWidth cannot be told apart from a missing one: it is left out when the
+	// event is broadcast, and clients draw it with their default width.
+	if p.LineWidth != 0 && (p.LineWidth < 1 || p.LineWidth > maxLineWidth) {
+		return invalidPayload("lineWidth must be between 1 and 50, or omitted")
+	}
+	return nil
+}
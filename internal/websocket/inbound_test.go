@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+func TestValidateDrawEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload domain.DrawEventPayload
+		wantErr bool
+	}{
+		{name: "defaults", payload: domain.DrawEventPayload{X: 10, Y: 20}},
+		{name: "styled", payload: domain.DrawEventPayload{X: -1.5, Y: 2.25, Color: "#2f8f5b", LineWidth: 4}},
+		{name: "short color", payload: domain.DrawEventPayload{Color: "#fff"}},
+		{name: "fractional width", payload: domain.DrawEventPayload{LineWidth: 1.5}},
+		{name: "widest", payload: domain.DrawEventPayload{LineWidth: maxLineWidth}},
+		{name: "width below 1", payload: domain.DrawEventPayload{LineWidth: 0.5}, wantErr: true},
+		{name: "negative width", payload: domain.DrawEventPayload{LineWidth: -2}, wantErr: true},
+		{name: "too wide", payload: domain.DrawEventPayload{LineWidth: maxLineWidth + 1}, wantErr: true},
+		{name: "coordinate out of range", payload: domain.DrawEventPayload{X: maxDrawCoordinate + 1}, wantErr: true},
+		{name: "color name", payload: domain.DrawEventPayload{Color: "red"}, wantErr: true},
+		{name: "color injection", payload: domain.DrawEventPayload{Color: "#fff;background:url(x)"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.payload
+			err := validateDrawEvent(&domain.Message{Type: "draw_move"}, &p)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDrawEvent(%+v) error = %v, want error %v", tt.payload, err, tt.wantErr)
+			}
+		})
+	}
+}
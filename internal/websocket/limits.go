@@ -0,0 +1,64 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/ratelimit"
+	"golang.org/x/time/rate"
+)
+
+// Message rate classes. Drawing produces far more messages than chatting, so each
+// class has its own rate. Changes to the images on a board are kept apart from
+// drawing since they are more expensive for the server.
+const (
+	rateClassChat   = "chat"
+	rateClassDraw   = "draw"
+	rateClassTyping = "typing"
+	rateClassBoard  = "board"
+)
+
+// MessageRates configures how fast a single connection may send each class of
+// message. A connection sending more than MaxViolations invalid messages or
+// messages over its limits within ViolationWindow is disconnected; a zero
+// MaxViolations never disconnects.
+type MessageRates struct {
+	Chat   ratelimit.Rate
+	Draw   ratelimit.Rate
+	Typing ratelimit.Rate
+	Board  ratelimit.Rate
+
+	MaxViolations   int
+	ViolationWindow time.Duration
+}
+
+// newLimiters creates the per-class limiters of a new connection. Unlimited classes
+// have no limiter.
+func (r MessageRates) newLimiters() map[string]*rate.Limiter {
+	return map[string]*rate.Limiter{
+		rateClassChat:   r.Chat.NewLimiter(),
+		rateClassDraw:   r.Draw.NewLimiter(),
+		rateClassTyping: r.Typing.NewLimiter(),
+		rateClassBoard:  r.Board.NewLimiter(),
+	}
+}
+
+// rateClass returns the rate class of a message type. Anything that is not drawing,
+// typing or changing board images, including unknown types, counts as chat.
+func rateClass(msgType string) string {
+	switch msgType {
+	case "draw_start", "draw_move", "draw_end":
+		return rateClassDraw
+	case "typing_start", "typing_stop":
+		return rateClassTyping
+	case "image_add", "image_update", "image_remove":
+		return rateClassBoard
+	}
+	return rateClassChat
+}
+
+// ConnLimits bounds the number of concurrent WebSocket connections of a single user
+// and from a single IP address. Zero limits are unlimited.
+type ConnLimits struct {
+	PerUser int
+	PerIP   int
+}
@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/richtext"
+)
+
+// maxMentionsPerMessage caps how many distinct users a single message can notify.
+const maxMentionsPerMessage = 20
+
+// resolveMentions matches the @usernames of a stored chat message against the members
+// of its room, records the mentions and sets them on the message. The sender never
+// mentions themself.
+func (h *Hub) resolveMentions(message *domain.Message) {
+	text, _ := message.Payload.(string)
+	userIDs, ok := h.mentionedUsers(message.ID, message.RoomID, message.Sender, text)
+	if !ok || len(userIDs) == 0 {
+		return
+	}
+	if err := h.repo.SaveMentions(context.Background(), message.ID, message.RoomID, userIDs); err != nil {
+		slog.Error("Failed to save mentions", "error", err, "messageID", message.ID)
+		return
+	}
+	message.Mentions = userIDs
+}
+
+// resolveEditedMentions updates the mentions of an edited chat message to match its
+// new content, and notifies the users it mentions for the first time.
+func (h *Hub) resolveEditedMentions(original *domain.Message, content string) {
+	userIDs, ok := h.mentionedUsers(original.ID, original.RoomID, original.Sender, content)
+	if !ok {
+		return
+	}
+	added, err := h.repo.ReplaceMentions(context.Background(), original.ID, original.RoomID, userIDs)
+	if err != nil {
+		slog.Error("Failed to update mentions", "error", err, "messageID", original.ID)
+		return
+	}
+	h.notifyMentions(&domain.Message{
+		ID:         original.ID,
+		Payload:    content,
+		Sender:     original.Sender,
+		SenderName: original.SenderName,
+		RoomID:     original.RoomID,
+		Timestamp:  original.Timestamp,
+		Mentions:   added,
+	})
+}
+
+// mentionedUsers returns the IDs of the members of a room mentioned in the content of
+// a chat message, other than its sender. It reports false if they could not be looked
+// up.
+func (h *Hub) mentionedUsers(messageID int64, roomID, senderID, text string) ([]string, bool) {
+	names := richtext.Mentions(text)
+	if len(names) == 0 {
+		return nil, true
+	}
+	if len(names) > maxMentionsPerMessage {
+		names = names[:maxMentionsPerMessage]
+	}
+
+	members, err := h.repo.FindRoomMembersByUsernames(context.Background(), roomID, names)
+	if err != nil {
+		slog.Error("Failed to resolve mentions", "error", err, "messageID", messageID)
+		return nil, false
+	}
+	var userIDs []string
+	for _, member := range members {
+		if member.ID != senderID {
+			userIDs = append(userIDs, member.ID)
+		}
+	}
+	return userIDs, true
+}
+
+// notifyMentions sends a `mention` notification to every connection of the users
+// mentioned in a chat message, whichever room they are in.
+func (h *Hub) notifyMentions(message *domain.Message) {
+	if len(message.Mentions) == 0 {
+		return
+	}
+	text, _ := message.Payload.(string)
+	h.notifyUsers(message.Mentions, &domain.Message{
+		Type: "mention",
+		Payload: &domain.Mention{
+			MessageID:  message.ID,
+			RoomID:     message.RoomID,
+			SenderID:   message.Sender,
+			SenderName: message.SenderName,
+			Content:    text,
+			Timestamp:  message.Timestamp,
+		},
+		Sender:     message.Sender,
+		SenderName: message.SenderName,
+		RoomID:     message.RoomID,
+	})
+}
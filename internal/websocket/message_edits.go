@@ -0,0 +1,139 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+)
+
+// handleEditMessage applies an `edit_message` request and broadcasts the new content
+// to the room as `message_updated`. The mentions of the message follow its content.
+func (h *Hub) handleEditMessage(editor *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.MessageEditPayload)
+	if !ok {
+		return
+	}
+	original, ok := h.authorizeMessageChange(editor, message, payload.MessageID)
+	if !ok {
+		return
+	}
+	// The new content goes through the same filters as new messages, and the filter
+	// notices refer to the edited message.
+	message.ID = original.ID
+	content, flags, ok := h.filterContent(editor, message, payload.Content)
+	if !ok {
+		return
+	}
+	payload.Content = content
+
+	editedAt, err := h.repo.EditMessage(context.Background(), original.ID, editor.ID, payload.Content, message.HTML)
+	if errors.Is(err, repository.ErrNotFound) {
+		h.sendError(editor, message.ClientMsgID, domain.ErrorNotFound, "message not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to edit message", "error", err, "messageID", original.ID)
+		h.sendError(editor, message.ClientMsgID, domain.ErrorInternal, "message could not be edited")
+		return
+	}
+	h.sendAck(editor, message.ClientMsgID, original.ID, editedAt, false)
+	h.flagMessage(editor, message, flags)
+
+	h.broadcastToRoom(&domain.Message{
+		Type: "message_updated",
+		Payload: domain.MessageUpdatedPayload{
+			MessageID: original.ID,
+			Content:   payload.Content,
+			HTML:      message.HTML,
+			EditedBy:  editor.ID,
+			EditedAt:  editedAt,
+		},
+		Sender:     editor.ID,
+		SenderName: editor.Username,
+		RoomID:     original.RoomID,
+	})
+	h.resolveEditedMentions(original, payload.Content)
+}
+
+// handleDeleteMessage applies a `delete_message` request and broadcasts it to the
+// room as `message_deleted`.
+func (h *Hub) handleDeleteMessage(deleter *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.MessageEditPayload)
+	if !ok {
+		return
+	}
+	original, ok := h.authorizeMessageChange(deleter, message, payload.MessageID)
+	if !ok {
+		return
+	}
+
+	deletedAt, err := h.repo.DeleteMessage(context.Background(), original.ID, deleter.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		h.sendError(deleter, message.ClientMsgID, domain.ErrorNotFound, "message not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to delete message", "error", err, "messageID", original.ID)
+		h.sendError(deleter, message.ClientMsgID, domain.ErrorInternal, "message could not be deleted")
+		return
+	}
+	h.sendAck(deleter, message.ClientMsgID, original.ID, deletedAt, false)
+
+	h.broadcastToRoom(&domain.Message{
+		Type: "message_deleted",
+		Payload: domain.MessageDeletedPayload{
+			MessageID: original.ID,
+			DeletedBy: deleter.ID,
+			DeletedAt: deletedAt,
+		},
+		Sender:     deleter.ID,
+		SenderName: deleter.Username,
+		RoomID:     original.RoomID,
+	})
+
+	// Deleted messages cannot stay pinned.
+	unpinned, err := h.repo.UnpinMessage(context.Background(), original.RoomID, original.ID)
+	if err != nil {
+		slog.Error("Failed to unpin deleted message", "error", err, "messageID", original.ID)
+	}
+	if unpinned {
+		h.broadcastPins(deleter, original.RoomID)
+	}
+}
+
+// authorizeMessageChange loads the chat message a client wants to edit or delete and
+// checks that the client is either its author or a moderator of the room. The client
+// is sent an error if not.
+func (h *Hub) authorizeMessageChange(c *Client, message *domain.Message, messageID int64) (*domain.Message, bool) {
+	original, ok := h.loadRoomMessage(c, message, messageID)
+	if !ok {
+		return nil, false
+	}
+	if original.Sender != c.ID && !h.isModerator(c.RoomID, c.ID) {
+		h.sendError(c, message.ClientMsgID, domain.ErrorUnauthorized, "not allowed to change this message")
+		return nil, false
+	}
+	return original, true
+}
+
+// loadRoomMessage loads a chat message referenced by a client request and checks that
+// it belongs to the client's room and has not been deleted. The client is sent an
+// error if not.
+func (h *Hub) loadRoomMessage(c *Client, message *domain.Message, messageID int64) (*domain.Message, bool) {
+	original, err := h.repo.GetMessageByID(context.Background(), messageID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Failed to load message", "error", err, "messageID", messageID)
+		}
+		h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "message not found")
+		return nil, false
+	}
+	if original.RoomID != c.RoomID || original.Deleted {
+		h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "message not found")
+		return nil, false
+	}
+	return original, true
+}
@@ -0,0 +1,14 @@
+package websocket
+
+import "expvar"
+
+// Rate limiting metrics, published with the other expvar variables.
+var (
+	// rateLimitedMessages counts the messages refused by the rate limits, by rate
+	// class.
+	rateLimitedMessages = expvar.NewMap("websocket_rate_limited_messages")
+
+	// policyDisconnects counts the clients disconnected for repeatedly sending
+	// invalid messages or exceeding their rate limits.
+	policyDisconnects = expvar.NewInt("websocket_policy_disconnects")
+)
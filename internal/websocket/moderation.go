@@ -0,0 +1,198 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+	"github.com/gorilla/websocket"
+)
+
+// maxMuteDuration is the longest a user can be muted for.
+const maxMuteDuration = 30 * 24 * time.Hour
+
+// maxModerationReasonLength is the maximum number of characters in a moderation reason.
+const maxModerationReasonLength = 500
+
+// isModerationCommand reports whether a message type is a moderator command.
+func isModerationCommand(msgType string) bool {
+	switch msgType {
+	case "kick_user", "mute_user", "unmute_user", "ban_user", "unban_user":
+		return true
+	}
+	return false
+}
+
+// handleModeration applies a moderator command to a user of the moderator's room,
+// records it in the room's audit trail and announces it to the room, including the
+// affected user, as `moderation_action`. Kicked and banned users are disconnected
+// from the room.
+func (h *Hub) handleModeration(c *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.ModerationPayload)
+	if !ok {
+		return
+	}
+	if utf8.RuneCountInString(payload.Reason) > maxModerationReasonLength {
+		h.sendError(c, message.ClientMsgID, domain.ErrorTooLarge, "reason is too long")
+		return
+	}
+	if !h.canModerate(c, message, payload.UserID) {
+		return
+	}
+
+	ctx := context.Background()
+	action := &domain.ModerationAction{
+		RoomID:      c.RoomID,
+		UserID:      payload.UserID,
+		ModeratorID: c.ID,
+		Reason:      payload.Reason,
+	}
+	var err error
+	switch message.Type {
+	case "kick_user":
+		action.Action = domain.ModerationKick
+
+	case "mute_user":
+		duration := time.Duration(payload.DurationSeconds) * time.Second
+		if duration <= 0 || duration > maxMuteDuration {
+			h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "invalid mute duration")
+			return
+		}
+		action.Action = domain.ModerationMute
+		until := time.Now().Add(duration)
+		action.ExpiresAt = &until
+		err = h.repo.MuteUser(ctx, c.RoomID, payload.UserID, c.ID, payload.Reason, until)
+
+	case "unmute_user":
+		action.Action = domain.ModerationUnmute
+		var muted bool
+		muted, err = h.repo.UnmuteUser(ctx, c.RoomID, payload.UserID)
+		if err == nil && !muted {
+			h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "user is not muted")
+			return
+		}
+
+	case "ban_user":
+		action.Action = domain.ModerationBan
+		err = h.repo.BanUser(ctx, c.RoomID, payload.UserID, c.ID, payload.Reason)
+
+	case "unban_user":
+		action.Action = domain.ModerationUnban
+		var banned bool
+		banned, err = h.repo.UnbanUser(ctx, c.RoomID, payload.UserID)
+		if err == nil && !banned {
+			h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "user is not banned")
+			return
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to apply moderation action", "error", err, "action", message.Type, "roomID", c.RoomID, "userID", payload.UserID)
+		h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "moderation action failed")
+		return
+	}
+
+	if err := h.repo.RecordModerationAction(ctx, action); err != nil {
+		slog.Error("Failed to record moderation action", "error", err, "action", action.Action, "roomID", c.RoomID)
+		action.CreatedAt = time.Now()
+	}
+	details := map[string]string{"action": action.Action}
+	if action.Reason != "" {
+		details["reason"] = action.Reason
+	}
+	if action.ExpiresAt != nil {
+		details["expires_at"] = action.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	h.auditLog.Record(domain.AuditEvent{
+		Type:       domain.AuditModeration,
+		ActorID:    c.ID,
+		ActorName:  c.Username,
+		RoomID:     c.RoomID,
+		TargetID:   payload.UserID,
+		RemoteAddr: c.RemoteAddr,
+		Details:    details,
+	})
+	slog.Info("Moderation action applied", "action", action.Action, "roomID", c.RoomID, "userID", payload.UserID, "moderatorID", c.ID)
+
+	h.broadcastToRoom(&domain.Message{
+		Type:       "moderation_action",
+		Payload:    action,
+		Sender:     c.ID,
+		SenderName: c.Username,
+		RoomID:     c.RoomID,
+	})
+
+	switch action.Action {
+	case domain.ModerationMute:
+		h.setMuted(c.RoomID, payload.UserID, *action.ExpiresAt)
+	case domain.ModerationUnmute:
+		h.setMuted(c.RoomID, payload.UserID, time.Time{})
+	case domain.ModerationKick:
+		h.disconnectUser(c.RoomID, payload.UserID, websocket.FormatCloseMessage(closeKicked, "kicked from the room"))
+	case domain.ModerationBan:
+		h.disconnectUser(c.RoomID, payload.UserID, websocket.FormatCloseMessage(closeBanned, "banned from the room"))
+	}
+}
+
+// canModerate checks that a client may apply moderation commands to a user of its
+// room: moderators may moderate regular members, and only the owner may moderate
+// moderators. Nobody can moderate the owner or themselves. The client is sent an
+// error if not.
+func (h *Hub) canModerate(c *Client, message *domain.Message, userID string) bool {
+	ctx := context.Background()
+	if userID == c.ID {
+		h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "you cannot moderate yourself")
+		return false
+	}
+	callerRole, err := h.repo.GetRoomRole(ctx, c.RoomID, c.ID)
+	if err != nil {
+		slog.Error("Failed to load room role", "error", err, "roomID", c.RoomID, "userID", c.ID)
+		h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "moderation action failed")
+		return false
+	}
+	if callerRole != domain.RoleOwner && callerRole != domain.RoleModerator {
+		h.sendError(c, message.ClientMsgID, domain.ErrorUnauthorized, "only moderators can moderate users")
+		return false
+	}
+	if _, err := h.repo.FindUserByID(ctx, userID); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Failed to load user", "error", err, "userID", userID)
+		}
+		h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "user not found")
+		return false
+	}
+	targetRole, err := h.repo.GetRoomRole(ctx, c.RoomID, userID)
+	if err != nil {
+		slog.Error("Failed to load room role", "error", err, "roomID", c.RoomID, "userID", userID)
+		h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "moderation action failed")
+		return false
+	}
+	if targetRole == domain.RoleOwner || targetRole == domain.RoleModerator && callerRole != domain.RoleOwner {
+		h.sendError(c, message.ClientMsgID, domain.ErrorUnauthorized, "not allowed to moderate this user")
+		return false
+	}
+	return true
+}
+
+// setMuted updates the mute of every connection of a user to a room.
+func (h *Hub) setMuted(roomID, userID string, until time.Time) {
+	for c := range h.clients[userID] {
+		if c.RoomID == roomID {
+			c.setMutedUntil(until)
+		}
+	}
+}
+
+// disconnectUser removes every connection of a user from a room, closing them with
+// the given close message.
+func (h *Hub) disconnectUser(roomID, userID string, closeFrame []byte) {
+	for c := range h.clients[userID] {
+		if c.RoomID == roomID {
+			c.closeFrame = closeFrame
+			h.removeClient(c)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// maxPinnedMessages caps the number of messages pinned to a single room.
+const maxPinnedMessages = 50
+
+// handlePin applies a `pin_message` or `unpin_message` request from a moderator and
+// broadcasts the updated pins of the room as `pins_updated`.
+func (h *Hub) handlePin(c *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.PinPayload)
+	if !ok {
+		return
+	}
+	if !h.isModerator(c.RoomID, c.ID) {
+		h.sendError(c, message.ClientMsgID, domain.ErrorUnauthorized, "only moderators can pin messages")
+		return
+	}
+	target, ok := h.loadRoomMessage(c, message, payload.MessageID)
+	if !ok {
+		return
+	}
+
+	if message.Type == "pin_message" {
+		count, err := h.repo.CountPinnedMessages(context.Background(), target.RoomID)
+		if err != nil {
+			slog.Error("Failed to count pinned messages", "error", err, "roomID", target.RoomID)
+			h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "message could not be pinned")
+			return
+		}
+		if count >= maxPinnedMessages {
+			h.sendError(c, message.ClientMsgID, domain.ErrorLimitExceeded, "the room has too many pinned messages")
+			return
+		}
+		if err := h.repo.PinMessage(context.Background(), target.RoomID, target.ID, c.ID); err != nil {
+			slog.Error("Failed to pin message", "error", err, "messageID", target.ID)
+			h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "message could not be pinned")
+			return
+		}
+	} else {
+		unpinned, err := h.repo.UnpinMessage(context.Background(), target.RoomID, target.ID)
+		if err != nil {
+			slog.Error("Failed to unpin message", "error", err, "messageID", target.ID)
+			h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "message could not be unpinned")
+			return
+		}
+		if !unpinned {
+			h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "message is not pinned")
+			return
+		}
+	}
+
+	h.broadcastPins(c, target.RoomID)
+}
+
+// broadcastPins sends the current pinned messages of a room to the room as
+// `pins_updated`, on behalf of the client that changed them.
+func (h *Hub) broadcastPins(c *Client, roomID string) {
+	pins, err := h.repo.GetPinnedMessages(context.Background(), roomID)
+	if err != nil {
+		slog.Error("Failed to load pinned messages", "error", err, "roomID", roomID)
+		return
+	}
+	h.broadcastToRoom(&domain.Message{
+		Type:       "pins_updated",
+		Payload:    domain.PinsUpdatedPayload{Pins: pins},
+		Sender:     c.ID,
+		SenderName: c.Username,
+		RoomID:     roomID,
+	})
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/ratelimit"
+	"github.com/Lec7ral/WithWebSocket/internal/richtext"
+)
+
+// Protocol versions. Clients that negotiate nothing speak protocolV1, the original
+// protocol, and are never sent a `welcome`.
+//
+// Version 2 replaces the full `user_list_update` sent whenever someone joins or
+// leaves a room with `user_joined` and `user_left` deltas.
+const (
+	protocolV1 = 1
+	protocolV2 = 2
+)
+
+// protocolVersion describes how the server talks to clients of a protocol version.
+type protocolVersion struct {
+	// subprotocol is the Sec-WebSocket-Protocol name of the version.
+	subprotocol string
+
+	// binary is set for the versions that may use a binary codec.
+	binary bool
+
+	// skips lists the message types clients of the version do not receive.
+	skips map[string]bool
+
+	// features lists the optional parts of the protocol announced in `welcome`.
+	features []string
+}
+
+// baseFeatures are available in every protocol version.
+var baseFeatures = []string{
+	"acks", "resume", "threads", "reactions", "mentions", "attachments", "whiteboard_images",
+	"pins", "moderation", "direct_messages", "group_messages",
+}
+
+// protocolVersions lists the supported protocol versions.
+var protocolVersions = map[int]*protocolVersion{
+	protocolV1: {
+		subprotocol: "collabsphere.v1",
+		skips:       map[string]bool{"user_joined": true, "user_left": true},
+		features:    baseFeatures,
+	},
+	protocolV2: {
+		subprotocol: "collabsphere.v2",
+		binary:      true,
+		skips:       map[string]bool{"user_list_update": true},
+		features:    append(slices.Clone(baseFeatures), "presence_deltas"),
+	},
+}
+
+// subprotocols are offered during the WebSocket handshake, preferred first. A
+// version using a binary codec is named after both, as in "collabsphere.v2.msgpack".
+var subprotocols = []string{"collabsphere.v2.msgpack", "collabsphere.v2", "collabsphere.v1"}
+
+// supportedVersions lists the supported protocol versions in ascending order.
+func supportedVersions() []int {
+	versions := make([]int, 0, len(protocolVersions))
+	for v := range protocolVersions {
+		versions = append(versions, v)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// parseSubprotocol returns the protocol version and codec named by a subprotocol
+// chosen during the handshake, or 0 if none was chosen.
+func parseSubprotocol(subprotocol string) (version int, codecName string) {
+	for v, p := range protocolVersions {
+		if p.subprotocol == subprotocol {
+			return v, codecJSON
+		}
+		if name, ok := strings.CutPrefix(subprotocol, p.subprotocol+"."); ok && p.binary {
+			if _, ok := codecs[name]; ok {
+				return v, name
+			}
+		}
+	}
+	return 0, codecJSON
+}
+
+// encoding identifies how a client is sent messages.
+type encoding struct {
+	version int
+	codec   string
+}
+
+// messageEncoder encodes a message at most once per protocol version and codec,
+// however many clients use them.
+type messageEncoder struct {
+	msg    *domain.Message
+	frames map[encoding]*frame
+}
+
+func newMessageEncoder(msg *domain.Message) *messageEncoder {
+	return &messageEncoder{msg: msg, frames: make(map[encoding]*frame, 2)}
+}
+
+// frame returns the message encoded for a client. It reports false if the client
+// does not receive the message, or if it cannot be encoded.
+func (e *messageEncoder) frame(c *Client) (frame, bool) {
+	return e.frameFor(encoding{version: c.protocol, codec: c.codec})
+}
+
+func (e *messageEncoder) frameFor(enc encoding) (frame, bool) {
+	if f, ok := e.frames[enc]; ok {
+		return derefFrame(f)
+	}
+	var f *frame
+	if !protocolVersions[enc.version].skips[e.msg.Type] {
+		c := codecs[enc.codec]
+		data, err := c.encode(e.msg)
+		if err != nil {
+			slog.Error("Failed to encode message", "error", err, "type", e.msg.Type, "version", enc.version, "codec", enc.codec)
+		} else {
+			f = &frame{data: data, binary: c.binary}
+		}
+	}
+	e.frames[enc] = f
+	return derefFrame(f)
+}
+
+func derefFrame(f *frame) (frame, bool) {
+	if f == nil {
+		return frame{}, false
+	}
+	return *f, true
+}
+
+// handleHello negotiates the protocol version of a client that sent `hello`: the
+// newest version both sides support is chosen and announced with a `welcome`. The
+// preferred codec the client supports, if its version allows binary codecs, is used
+// from the next message on.
+func (h *Hub) handleHello(c *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.HelloPayload)
+	if !ok {
+		return
+	}
+	if c.negotiated {
+		h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "protocol version already negotiated")
+		return
+	}
+	version := 0
+	for _, v := range payload.Versions {
+		if _, ok := protocolVersions[v]; ok && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "no supported protocol version")
+		return
+	}
+	codecName := codecJSON
+	if protocolVersions[version].binary {
+		for _, name := range codecNames {
+			if slices.Contains(payload.Encodings, name) {
+				codecName = name
+				break
+			}
+		}
+	}
+	c.protocol, c.negotiated = version, true
+	welcome := h.welcomeMessage(c)
+	welcome.Payload.(*domain.WelcomePayload).Encoding = codecName
+	h.sendToClient(c, welcome)
+	c.codec = codecName
+}
+
+// welcomeMessage describes the negotiated protocol to a client.
+func (h *Hub) welcomeMessage(c *Client) *domain.Message {
+	rates := make(map[string]domain.RateLimit)
+	for class, r := range map[string]ratelimit.Rate{
+		rateClassChat:   h.rates.Chat,
+		rateClassDraw:   h.rates.Draw,
+		rateClassTyping: h.rates.Typing,
+		rateClassBoard:  h.rates.Board,
+	} {
+		if !r.Unlimited() {
+			rates[class] = domain.RateLimit{PerSecond: r.PerSecond, Burst: r.Burst}
+		}
+	}
+	return &domain.Message{
+		Type: "welcome",
+		Payload: &domain.WelcomePayload{
+			Version:   c.protocol,
+			Protocol:  protocolVersions[c.protocol].subprotocol,
+			Versions:  supportedVersions(),
+			Encoding:  c.codec,
+			Encodings: codecNames,
+			Features:  protocolVersions[c.protocol].features,
+			Limits: domain.ProtocolLimits{
+				MaxMessageSize:   maxMessageSize,
+				MaxContentLength: richtext.MaxLength,
+				Rates:            rates,
+			},
+			ConnID:     c.ConnID,
+			ServerTime: time.Now(),
+		},
+	}
+}
@@ -0,0 +1,49 @@
+package websocket
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// maxEmojiLength is the maximum size in bytes of a reaction emoji.
+const maxEmojiLength = 32
+
+// handleReaction applies an `add_reaction` or `remove_reaction` request and broadcasts
+// the updated reactions of the message to the room as `reactions_updated`.
+func (h *Hub) handleReaction(c *Client, message *domain.Message) {
+	payload, ok := message.Payload.(domain.ReactionPayload)
+	if !ok {
+		return
+	}
+	target, ok := h.loadRoomMessage(c, message, payload.MessageID)
+	if !ok {
+		return
+	}
+
+	var err error
+	if message.Type == "add_reaction" {
+		err = h.repo.AddReaction(context.Background(), target.ID, c.ID, payload.Emoji)
+	} else {
+		err = h.repo.RemoveReaction(context.Background(), target.ID, c.ID, payload.Emoji)
+	}
+	if err != nil {
+		slog.Error("Failed to update reaction", "error", err, "messageID", target.ID)
+		h.sendError(c, message.ClientMsgID, domain.ErrorInternal, "reaction could not be saved")
+		return
+	}
+
+	reactions, err := h.repo.GetReactions(context.Background(), target.ID)
+	if err != nil {
+		slog.Error("Failed to load reactions", "error", err, "messageID", target.ID)
+		return
+	}
+	h.broadcastToRoom(&domain.Message{
+		Type:       "reactions_updated",
+		Payload:    domain.ReactionsUpdatedPayload{MessageID: target.ID, Reactions: reactions},
+		Sender:     c.ID,
+		SenderName: c.Username,
+		RoomID:     target.RoomID,
+	})
+}
@@ -0,0 +1,83 @@
+package websocket
+
+import "github.com/Lec7ral/WithWebSocket/internal/domain"
+
+// replayBufferSize is the number of recent events kept per room for resuming clients.
+const replayBufferSize = 512
+
+// replayHistoryLimit caps how many chat messages are loaded from the database when a
+// resuming client has fallen too far behind for the in-memory buffer.
+const replayHistoryLimit = 200
+
+// isReplayable reports whether events of the given type are sequenced and replayed
+// to clients that reconnect. Presence and typing updates are transient and are not.
+func isReplayable(msgType string) bool {
+	switch msgType {
+	case "text_message", "attachment", "draw_start", "draw_move", "draw_end", "clear_board",
+		"image_add", "image_update", "image_remove",
+		"message_updated", "message_deleted", "thread_updated", "reactions_updated", "pins_updated",
+		"system_announcement":
+		return true
+	}
+	return false
+}
+
+// sequencedEvent is a broadcast room event together with its sequence number. The
+// event is kept decoded since clients using different codecs may replay it.
+type sequencedEvent struct {
+	seq int64
+	msg *domain.Message
+
+	// sender is the client that caused the event, and echoed whether the event was
+	// also delivered back to it. Events that were not echoed are not replayed to
+	// their sender either.
+	sender string
+	echoed bool
+}
+
+// replayBuffer is a bounded ring of the most recent sequenced events of a room.
+type replayBuffer struct {
+	events []sequencedEvent
+	next   int
+	count  int
+
+	// evicted is the highest sequence number no longer available in the buffer.
+	// Events up to and including it have to be recovered some other way.
+	evicted int64
+}
+
+// newReplayBuffer creates an empty buffer for a room whose latest event is seq.
+func newReplayBuffer(seq int64) *replayBuffer {
+	return &replayBuffer{
+		events:  make([]sequencedEvent, replayBufferSize),
+		evicted: seq,
+	}
+}
+
+// add appends an event, evicting the oldest one when the buffer is full.
+func (b *replayBuffer) add(ev sequencedEvent) {
+	if b.count == len(b.events) {
+		b.evicted = b.events[b.next].seq
+	} else {
+		b.count++
+	}
+	b.events[b.next] = ev
+	b.next = (b.next + 1) % len(b.events)
+}
+
+// since returns the buffered events newer than seq that clientID should receive,
+// oldest first. It reports false if some of those events have already been evicted.
+func (b *replayBuffer) since(seq int64, clientID string) ([]*domain.Message, bool) {
+	if seq < b.evicted {
+		return nil, false
+	}
+	events := make([]*domain.Message, 0)
+	start := (b.next - b.count + len(b.events)) % len(b.events)
+	for i := 0; i < b.count; i++ {
+		ev := b.events[(start+i)%len(b.events)]
+		if ev.seq > seq && (ev.echoed || ev.sender != clientID) {
+			events = append(events, ev.msg)
+		}
+	}
+	return events, true
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+)
+
+// smallReplayBuffer returns a buffer of size events for a room whose latest event is seq.
+func smallReplayBuffer(size int, seq int64) *replayBuffer {
+	b := newReplayBuffer(seq)
+	b.events = make([]sequencedEvent, size)
+	return b
+}
+
+// addEvents adds events with sequence numbers from and to, inclusive, sent by sender.
+func addEvents(b *replayBuffer, from, to int64, sender string, echoed bool) {
+	for seq := from; seq <= to; seq++ {
+		b.add(sequencedEvent{seq: seq, msg: &domain.Message{Seq: seq}, sender: sender, echoed: echoed})
+	}
+}
+
+func seqs(msgs []*domain.Message) []int64 {
+	out := make([]int64, len(msgs))
+	for i, m := range msgs {
+		out[i] = m.Seq
+	}
+	return out
+}
+
+func TestReplayBufferSince(t *testing.T) {
+	tests := []struct {
+		name   string
+		start  int64
+		last   int64
+		since  int64
+		want   []int64
+		wantOK bool
+	}{
+		{name: "empty", start: 10, last: 10, since: 10, want: []int64{}, wantOK: true},
+		{name: "partly filled", start: 10, last: 13, since: 11, want: []int64{12, 13}, wantOK: true},
+		{name: "up to date", start: 10, last: 13, since: 13, want: []int64{}, wantOK: true},
+		{name: "before the room was loaded", start: 10, last: 13, since: 9, wantOK: false},
+		{name: "full", start: 0, last: 4, since: 0, want: []int64{1, 2, 3, 4}, wantOK: true},
+		{name: "wrapped", start: 0, last: 7, since: 4, want: []int64{5, 6, 7}, wantOK: true},
+		{name: "wrapped, oldest kept", start: 0, last: 7, since: 3, want: []int64{4, 5, 6, 7}, wantOK: true},
+		{name: "evicted", start: 0, last: 7, since: 2, wantOK: false},
+		{name: "wrapped twice", start: 0, last: 10, since: 7, want: []int64{8, 9, 10}, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := smallReplayBuffer(4, tt.start)
+			addEvents(b, tt.start+1, tt.last, "alice", true)
+			got, ok := b.since(tt.since, "bob")
+			if ok != tt.wantOK {
+				t.Fatalf("since(%d) ok = %v, want %v", tt.since, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if gotSeqs := seqs(got); !slices.Equal(gotSeqs, tt.want) {
+				t.Errorf("since(%d) = %v, want %v", tt.since, gotSeqs, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayBufferEvicted(t *testing.T) {
+	b := smallReplayBuffer(4, 0)
+	addEvents(b, 1, 4, "alice", true)
+	if b.evicted != 0 {
+		t.Errorf("evicted = %d before the buffer wrapped, want 0", b.evicted)
+	}
+	addEvents(b, 5, 6, "alice", true)
+	if b.evicted != 2 {
+		t.Errorf("evicted = %d, want 2", b.evicted)
+	}
+}
+
+func TestReplayBufferSkipsUnechoedEvents(t *testing.T) {
+	b := smallReplayBuffer(4, 0)
+	addEvents(b, 1, 1, "alice", false)
+	addEvents(b, 2, 2, "bob", true)
+	addEvents(b, 3, 3, "alice", true)
+
+	if got, _ := b.since(0, "alice"); !slices.Equal(seqs(got), []int64{2, 3}) {
+		t.Errorf("since(0) for the sender = %v, want [2 3]", seqs(got))
+	}
+	if got, _ := b.since(0, "carol"); !slices.Equal(seqs(got), []int64{1, 2, 3}) {
+		t.Errorf("since(0) for others = %v, want [1 2 3]", seqs(got))
+	}
+}
+
+func TestMissedMessages(t *testing.T) {
+	h := NewHub(nil, nil, nil, MessageRates{})
+	client := &Client{ID: "u1", RoomID: "r1"}
+	buf := newReplayBuffer(10)
+	h.replays["r1"] = buf
+	buf.add(sequencedEvent{seq: 11, msg: &domain.Message{Type: "text_message", Seq: 11}, echoed: true})
+	buf.add(sequencedEvent{seq: 12, msg: &domain.Message{Type: "draw_move", Seq: 12}, echoed: true})
+	buf.add(sequencedEvent{seq: 13, msg: &domain.Message{Type: "attachment", Seq: 13}, echoed: true})
+
+	// Messages saved after the registration loaded them are taken from the buffer.
+	req := &registrationRequest{since: 5, missed: []*domain.Message{{Seq: 7}, {Seq: 10}}}
+	if got, want := seqs(h.missedMessages(client, req)), []int64{7, 10, 11, 13}; !slices.Equal(got, want) {
+		t.Errorf("missed messages = %v, want %v", got, want)
+	}
+
+	// Without the events since the loaded messages, only those are returned.
+	req = &registrationRequest{since: 2, missed: []*domain.Message{{Seq: 4}}}
+	if got, want := seqs(h.missedMessages(client, req)), []int64{4}; !slices.Equal(got, want) {
+		t.Errorf("missed messages = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+)
+
+// seqRepo keeps the sequence counter of a single room.
+type seqRepo struct {
+	repository.Repository
+
+	reserved int64
+	reserves int
+}
+
+func (r *seqRepo) GetRoomSeq(context.Context, string) (int64, error) {
+	return r.reserved, nil
+}
+
+func (r *seqRepo) ReserveRoomSeqs(_ context.Context, _ string, n int64) (int64, error) {
+	r.reserved += n
+	r.reserves++
+	return r.reserved, nil
+}
+
+func TestSequenceNumbers(t *testing.T) {
+	repo := &seqRepo{reserved: 5}
+	h := NewHub(repo, nil, nil, MessageRates{})
+
+	if got := h.nextSeq("r1"); got != 6 {
+		t.Fatalf("first seq = %d, want 6", got)
+	}
+	if repo.reserves != 1 {
+		t.Errorf("%d reservations for the first seq, want 1", repo.reserves)
+	}
+
+	// A number given back is handed out again, so a failed save leaves no gap.
+	seq := h.nextSeq("r1")
+	h.releaseSeq("r1", seq)
+	if got := h.nextSeq("r1"); got != seq {
+		t.Errorf("seq after release = %d, want %d", got, seq)
+	}
+	// Only the latest number can be given back.
+	h.nextSeq("r1")
+	h.releaseSeq("r1", seq)
+	if got := h.currentSeq("r1"); got != seq+1 {
+		t.Errorf("current seq = %d after releasing an older number, want %d", got, seq+1)
+	}
+
+	for range seqBlockSize {
+		h.nextSeq("r1")
+	}
+	if repo.reserves != 2 {
+		t.Errorf("%d reservations after a block was used up, want 2", repo.reserves)
+	}
+
+	// After a restart, numbering resumes after everything reserved before.
+	last := h.currentSeq("r1")
+	restarted := NewHub(repo, nil, nil, MessageRates{})
+	if got := restarted.nextSeq("r1"); got <= last {
+		t.Errorf("seq after restart = %d, want more than %d", got, last)
+	}
+}
@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"mime"
+	"slices"
+	"strings"
+
+	"github.com/Lec7ral/WithWebSocket/internal/domain"
+	"github.com/Lec7ral/WithWebSocket/internal/repository"
+	"github.com/google/uuid"
+)
+
+// maxWhiteboardImages caps the number of images placed on a single board.
+const maxWhiteboardImages = 100
+
+// maxWhiteboardImageSize is the largest width and height of an image on the board.
+const maxWhiteboardImageSize = 10000
+
+// handleWhiteboardImage applies an `image_add`, `image_update` or `image_remove`
+// request to the board of the client's room, saves the board and broadcasts the
+// element to the room. Added images must be image attachments of the same room.
+// Updates come in quick succession while an image is dragged, so the boards they
+// change are only saved every boardSaveInterval.
+func (h *Hub) handleWhiteboardImage(c *Client, message *domain.Message) {
+	image, ok := message.Payload.(domain.WhiteboardImage)
+	if !ok {
+		return
+	}
+	state, ok := h.whiteboardStates[c.RoomID]
+	if !ok {
+		return
+	}
+
+	switch message.Type {
+	case "image_add":
+		if len(state.Images) >= maxWhiteboardImages {
+			h.sendError(c, message.ClientMsgID, domain.ErrorLimitExceeded, "the board has too many images")
+			return
+		}
+		if !validImagePlacement(&image) {
+			h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "invalid image placement")
+			return
+		}
+		attachment, err := h.repo.GetAttachment(context.Background(), image.AttachmentID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			slog.Error("Failed to load attachment", "error", err, "attachmentID", image.AttachmentID)
+		}
+		if err != nil || attachment.RoomID != c.RoomID {
+			h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "attachment not found")
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+		if !strings.HasPrefix(mediaType, "image/") {
+			h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "attachment is not an image")
+			return
+		}
+		image.ID = uuid.NewString()
+		image.URL = attachment.URL
+		image.AddedBy = c.ID
+		state.Images = append(state.Images, &image)
+
+	case "image_update":
+		existing := findWhiteboardImage(state, image.ID)
+		if existing == nil {
+			h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "image not found")
+			return
+		}
+		if !validImagePlacement(&image) {
+			h.sendError(c, message.ClientMsgID, domain.ErrorInvalidPayload, "invalid image placement")
+			return
+		}
+		// Only the placement of an image can change.
+		existing.X, existing.Y = image.X, image.Y
+		existing.Width, existing.Height = image.Width, image.Height
+		existing.Rotation = image.Rotation
+		image = *existing
+		h.dirtyBoards[c.RoomID] = true
+
+	case "image_remove":
+		existing := findWhiteboardImage(state, image.ID)
+		if existing == nil {
+			h.sendError(c, message.ClientMsgID, domain.ErrorNotFound, "image not found")
+			return
+		}
+		image = *existing
+		state.Images = slices.DeleteFunc(state.Images, func(i *domain.WhiteboardImage) bool { return i == existing })
+	}
+
+	if message.Type != "image_update" {
+		h.saveWhiteboardState(c.RoomID)
+	}
+	message.Payload = &image
+	h.broadcastToRoom(message)
+}
+
+// saveWhiteboardState persists the current board of a room in the background.
+func (h *Hub) saveWhiteboardState(roomID string) {
+	delete(h.dirtyBoards, roomID)
+	state, ok := h.whiteboardStates[roomID]
+	if !ok {
+		return
+	}
+	h.boards.save(roomID, cloneWhiteboardState(state))
+}
+
+// saveChangedBoards persists the boards changed since they were last saved.
+func (h *Hub) saveChangedBoards() {
+	for roomID := range h.dirtyBoards {
+		h.saveWhiteboardState(roomID)
+	}
+}
+
+// validImagePlacement checks the position, size and rotation of an image and
+// normalizes its rotation to [0, 360).
+func validImagePlacement(image *domain.WhiteboardImage) bool {
+	for _, v := range []float64{image.X, image.Y, image.Width, image.Height, image.Rotation} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	if image.Width <= 0 || image.Height <= 0 || image.Width > maxWhiteboardImageSize || image.Height > maxWhiteboardImageSize {
+		return false
+	}
+	image.Rotation = math.Mod(image.Rotation, 360)
+	if image.Rotation < 0 {
+		image.Rotation += 360
+	}
+	return true
+}
+
+// findWhiteboardImage returns the image element with the given ID, or nil.
+func findWhiteboardImage(state *domain.WhiteboardState, id string) *domain.WhiteboardImage {
+	for _, image := range state.Images {
+		if image.ID == id {
+			return image
+		}
+	}
+	return nil
+}
@@ -14,4 +14,207 @@ CREATE TABLE IF NOT EXISTS whiteboards (
     room_id VARCHAR(255) PRIMARY KEY,
     state JSONB NOT NULL,
     updated_at TIMESTAMPTZ DEFAULT NOW()
-);
\ No newline at end of file
+);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_msg_id VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_sender_client_msg_id ON messages (sender_id, client_msg_id);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS seq BIGINT;
+CREATE INDEX IF NOT EXISTS idx_messages_room_seq ON messages (room_id, seq);
+
+CREATE TABLE IF NOT EXISTS direct_messages (
+    id SERIAL PRIMARY KEY,
+    sender_id VARCHAR(255) NOT NULL,
+    recipient_id VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    client_msg_id VARCHAR(255),
+    timestamp TIMESTAMPTZ DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_direct_messages_sender ON direct_messages (sender_id, recipient_id, id);
+CREATE INDEX IF NOT EXISTS idx_direct_messages_recipient ON direct_messages (recipient_id, sender_id, id);
+CREATE INDEX IF NOT EXISTS idx_direct_messages_pending ON direct_messages (recipient_id) WHERE delivered_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_direct_messages_sender_client_msg_id ON direct_messages (sender_id, client_msg_id);
+CREATE TABLE IF NOT EXISTS direct_message_reads (
+    user_id VARCHAR(255) NOT NULL,
+    peer_id VARCHAR(255) NOT NULL,
+    last_read_id INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (user_id, peer_id)
+);
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id VARCHAR(255) NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    joined_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (conversation_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id ON conversation_members (user_id);
+CREATE TABLE IF NOT EXISTS group_messages (
+    id SERIAL PRIMARY KEY,
+    conversation_id VARCHAR(255) NOT NULL REFERENCES conversations (id) ON DELETE CASCADE,
+    sender_id VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    client_msg_id VARCHAR(255),
+    timestamp TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_group_messages_conversation ON group_messages (conversation_id, id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_messages_sender_client_msg_id ON group_messages (sender_id, client_msg_id);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS deleted_by VARCHAR(255);
+CREATE TABLE IF NOT EXISTS message_edits (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    previous_payload TEXT NOT NULL,
+    edited_by VARCHAR(255) NOT NULL,
+    edited_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits (message_id);
+CREATE TABLE IF NOT EXISTS rooms (
+    id VARCHAR(255) PRIMARY KEY,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+-- seq is the highest sequence number reserved for the events of the room.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT 0;
+CREATE TABLE IF NOT EXISTS room_roles (
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    granted_by VARCHAR(255),
+    granted_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES messages (id);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS last_reply_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_messages_parent_id ON messages (parent_id, id);
+
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id INTEGER NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+
+CREATE TABLE IF NOT EXISTS room_members (
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    joined_at TIMESTAMPTZ DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_room_members_user_id ON room_members (user_id);
+CREATE TABLE IF NOT EXISTS message_mentions (
+    message_id INTEGER NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    user_id VARCHAR(255) NOT NULL,
+    room_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    read_at TIMESTAMPTZ,
+    PRIMARY KEY (message_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS idx_message_mentions_unread ON message_mentions (user_id, message_id) WHERE read_at IS NULL;
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS content_html TEXT;
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id VARCHAR(255) PRIMARY KEY,
+    room_id VARCHAR(255) NOT NULL,
+    uploader_id VARCHAR(255) NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    blob_key TEXT NOT NULL,
+    thumbnail_key TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_room_id ON attachments (room_id);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attachment_id VARCHAR(255) REFERENCES attachments (id);
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(payload, ''))) STORED;
+CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_messages_room_timestamp ON messages (room_id, timestamp);
+
+CREATE TABLE IF NOT EXISTS pinned_messages (
+    message_id INTEGER PRIMARY KEY REFERENCES messages (id) ON DELETE CASCADE,
+    room_id VARCHAR(255) NOT NULL,
+    pinned_by VARCHAR(255) NOT NULL,
+    pinned_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_room_id ON pinned_messages (room_id, pinned_at);
+
+CREATE TABLE IF NOT EXISTS room_bans (
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    banned_by VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS room_mutes (
+    room_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    muted_by VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id SERIAL PRIMARY KEY,
+    room_id VARCHAR(255) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    moderator_id VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_room_id ON moderation_actions (room_id, id);
+
+CREATE TABLE IF NOT EXISTS message_flags (
+    message_id INTEGER NOT NULL REFERENCES messages (id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    PRIMARY KEY (message_id, reason)
+);
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    type VARCHAR(64) NOT NULL,
+    actor_id VARCHAR(255),
+    actor_name VARCHAR(255),
+    room_id VARCHAR(255),
+    target_id VARCHAR(255),
+    remote_addr VARCHAR(255),
+    details JSONB
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_time ON audit_events (time);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_room_id ON audit_events (room_id, id);
+-- The audit log is append-only: rows can never be changed or removed.
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+DROP TRIGGER IF EXISTS audit_events_no_truncate ON audit_events;
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();